@@ -6,13 +6,18 @@ import (
 	"time"
 
 	"github.com/paulbellamy/ratecounter"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
 )
 
+// AvgCounter is safe for concurrent use.
 type AvgCounter struct {
+	*scrapeGauges
+
 	counter        *ratecounter.AvgRateCounter
 	samplingWindow time.Duration
 	eventType      string
-	total          uint64
+	total          *atomic.Uint64
 }
 
 // NewAvgCounter allows you to get the average of an event over the period of time.
@@ -34,7 +39,7 @@ func NewAvgCounter(samplingWindow time.Duration, eventType string) *AvgCounter {
 		counter:        ratecounter.NewAvgRateCounter(samplingWindow),
 		samplingWindow: samplingWindow,
 		eventType:      eventType,
-		total:          0,
+		total:          atomic.NewUint64(0),
 	}
 }
 
@@ -45,7 +50,7 @@ func (c *AvgCounter) IncBy(value int64) {
 	}
 
 	c.counter.Incr(value)
-	c.total += uint64(value)
+	c.total.Add(uint64(value))
 }
 
 func (c *AvgCounter) Average() float64 {
@@ -53,7 +58,7 @@ func (c *AvgCounter) Average() float64 {
 }
 
 func (c *AvgCounter) Total() uint64 {
-	return c.total
+	return c.total.Load()
 }
 
 func (c *AvgCounter) AverageString() string {
@@ -76,3 +81,17 @@ func samplingWindowToString(sampling time.Duration) string {
 		return sampling.String()
 	}
 }
+
+// MarshalLogObject logs the `average`, `total`, `description` (the event type) and
+// `window_seconds` fields.
+func (c *AvgCounter) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddFloat64("average", c.Average())
+	enc.AddUint64("total", c.Total())
+	enc.AddString("description", c.eventType)
+	enc.AddFloat64("window_seconds", c.samplingWindow.Seconds())
+	return nil
+}
+
+func (c *AvgCounter) MarshalJSON() ([]byte, error) {
+	return marshalObjectJSON(c)
+}
@@ -2,17 +2,37 @@ package dmetrics
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/paulbellamy/ratecounter"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
 )
 
+// avgDurationResolution is the number of slots the sampling window of an
+// [AvgDurationCounter] is divided in, the durations expiring one slot at a time.
+const avgDurationResolution = 20
+
+// AvgDurationCounter is safe for concurrent use.
 type AvgDurationCounter struct {
-	counter        *ratecounter.AvgRateCounter
+	*scrapeGauges
+
 	samplingWindow time.Duration
 	unit           time.Duration
-	total          int64
+	total          *atomic.Int64
 	description    string
+	clock          Clock
+
+	lock      sync.Mutex
+	slotWidth time.Duration
+	slots     []durationSlot
+}
+
+// durationSlot accumulates the durations added during the slot `index` of the clock
+type durationSlot struct {
+	index int64
+	sum   time.Duration
+	count int64
 }
 
 // NewAvgDurationCounter allows you to get teh average elapsed time of a given process
@@ -33,18 +53,33 @@ type AvgDurationCounter struct {
 // The `unit` parameter can be 0, in which case the unit will be inferred based on the
 // actual duration, e.g. if the average is 1.5s, the unit will be 1s while if the average is
 // 10us, the unit will be 10us.
-func NewAvgDurationCounter(samplingWindow time.Duration, unit time.Duration, description string) *AvgDurationCounter {
+//
+// The sampling window follows the clock configured with [CounterClock], a duration
+// added expires at most 1/20th of the window after it falls out of it.
+func NewAvgDurationCounter(samplingWindow time.Duration, unit time.Duration, description string, options ...CounterOption) *AvgDurationCounter {
+	slotWidth := samplingWindow / avgDurationResolution
+	if slotWidth <= 0 {
+		slotWidth = 1
+	}
+
+	slots := make([]durationSlot, avgDurationResolution)
+	for i := range slots {
+		slots[i].index = -1
+	}
+
 	return &AvgDurationCounter{
-		counter:        ratecounter.NewAvgRateCounter(samplingWindow),
 		samplingWindow: samplingWindow,
 		unit:           unit,
-		total:          0,
+		total:          atomic.NewInt64(0),
 		description:    description,
+		clock:          newCounterOptions(options).clock,
+		slotWidth:      slotWidth,
+		slots:          slots,
 	}
 }
 
 func (c *AvgDurationCounter) AddElapsedTime(start time.Time) {
-	elapsed := time.Since(start)
+	elapsed := c.clock.Since(start)
 	if elapsed <= 0 {
 		return
 	}
@@ -52,16 +87,45 @@ func (c *AvgDurationCounter) AddElapsedTime(start time.Time) {
 }
 
 func (c *AvgDurationCounter) AddDuration(dur time.Duration) {
-	c.counter.Incr(int64(dur))
-	c.total += int64(dur)
+	index := c.slotIndex()
+
+	c.lock.Lock()
+	slot := &c.slots[index%int64(len(c.slots))]
+	if slot.index != index {
+		// The slot was for a time that fell out of the sampling window
+		*slot = durationSlot{index: index}
+	}
+	slot.sum += dur
+	slot.count++
+	c.lock.Unlock()
+
+	c.total.Add(int64(dur))
 }
 
 func (c *AvgDurationCounter) Average() time.Duration {
-	return time.Duration(c.counter.Rate())
+	oldest := c.slotIndex() - int64(len(c.slots)) + 1
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var sum time.Duration
+	var count int64
+	for _, slot := range c.slots {
+		if slot.index >= oldest {
+			sum += slot.sum
+			count += slot.count
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return sum / time.Duration(count)
 }
 
 func (c *AvgDurationCounter) Total() time.Duration {
-	return time.Duration(c.total)
+	return time.Duration(c.total.Load())
 }
 
 func (c *AvgDurationCounter) AverageString() string {
@@ -71,3 +135,21 @@ func (c *AvgDurationCounter) AverageString() string {
 func (c *AvgDurationCounter) String() string {
 	return fmt.Sprintf("%s %s (avg over %s)", c.AverageString(), c.description, samplingWindowToString(c.samplingWindow))
 }
+
+// MarshalLogObject logs the `average_seconds`, `total_seconds`, `description` and
+// `window_seconds` fields.
+func (c *AvgDurationCounter) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddFloat64("average_seconds", c.Average().Seconds())
+	enc.AddFloat64("total_seconds", c.Total().Seconds())
+	enc.AddString("description", c.description)
+	enc.AddFloat64("window_seconds", c.samplingWindow.Seconds())
+	return nil
+}
+
+func (c *AvgDurationCounter) MarshalJSON() ([]byte, error) {
+	return marshalObjectJSON(c)
+}
+
+func (c *AvgDurationCounter) slotIndex() int64 {
+	return c.clock.Now().UnixNano() / int64(c.slotWidth)
+}
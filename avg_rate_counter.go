@@ -2,6 +2,7 @@ package dmetrics
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 	"strconv"
 	"sync"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/streamingfast/dmetrics/ring"
 	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
 )
 
 // avgRateCounter exists because we use a janitor that is invoked when the object embedding `avgRate
@@ -26,11 +28,41 @@ var _ avgRateCounter = (*AvgRateCounter)(nil)
 
 type AvgRateCounter struct {
 	*avgRate
+	*scrapeGauges
+
 	c *atomic.Uint64
 }
 
-func MustNewAvgRateCounter(samplingWindow time.Duration, period time.Duration, unit string) *AvgRateCounter {
-	a, err := NewAvgRateCounter(samplingWindow, period, unit)
+// CounterOption configures the optional behavior of the rate and duration counters.
+type CounterOption func(o *counterOptions)
+
+type counterOptions struct {
+	clock Clock
+}
+
+// CounterClock configures the clock driving the counter, defaults to [RealClock].
+// Mainly useful in tests with a [FakeClock].
+func CounterClock(clock Clock) CounterOption {
+	return func(o *counterOptions) {
+		o.clock = clock
+	}
+}
+
+func newCounterOptions(options []CounterOption) counterOptions {
+	o := counterOptions{clock: RealClock}
+	for _, option := range options {
+		option(&o)
+	}
+
+	if o.clock == nil {
+		o.clock = RealClock
+	}
+
+	return o
+}
+
+func MustNewAvgRateCounter(samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRateCounter {
+	a, err := NewAvgRateCounter(samplingWindow, period, unit, options...)
 	if err != nil {
 		panic(err)
 	}
@@ -58,9 +90,9 @@ func MustNewAvgRateCounter(samplingWindow time.Duration, period time.Duration, u
 // then when the "window moves" you would get
 //
 //	(3 + 0 + 7)/4 = 3.333 blocks/sec
-func NewAvgRateCounter(samplingWindow time.Duration, period time.Duration, unit string) (*AvgRateCounter, error) {
+func NewAvgRateCounter(samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRateCounter, error) {
 	a := &AvgRateCounter{c: atomic.NewUint64(0)}
-	avgRage, err := newAvgRate(a.count, samplingWindow, period, unit)
+	avgRage, err := newAvgRate(a.count, samplingWindow, period, unit, newCounterOptions(options).clock)
 	if err != nil {
 		return nil, fmt.Errorf("new avg rate counter: %w", err)
 	}
@@ -92,6 +124,10 @@ func (c *AvgRateCounter) Stop() {
 
 type CountableFunc = func() uint64
 
+// floatCountableFunc is the float64 flavor of [CountableFunc], for the Prometheus
+// sources having a fractional total like seconds spent.
+type floatCountableFunc = func() float64
+
 // NewAvgRateCounter AvgRateCounter can be used to extract the average rate of a Countable object
 // over a period of time. The computation is to accumulate the instant metric each <samplingWindow>
 // and obtain an average over <period> duration. The <period> must be greater than
@@ -102,18 +138,30 @@ type CountableFunc = func() uint64
 
 type avgRate struct {
 	//counter        prometheus.Collector
-	counterFunc    CountableFunc
+	counterFunc    floatCountableFunc
 	samplingWindow time.Duration
 	unit           string
 	bucketCount    uint64
+	clock          Clock
 	janitor        *janitor
 
-	totals      *ring.Ring[uint64]
-	actualTotal uint64
+	// decreaseAsNoProgress is for the sources that legitimately go backwards, like
+	// block heights on a reorg, a decrease then counting as no progress instead of a
+	// counter reset. Only set at creation.
+	decreaseAsNoProgress bool
+
+	// lock protects the fields below, written by the janitor goroutine
+	lock        sync.Mutex
+	totals      *ring.Ring[float64]
+	actualTotal float64
 	actualCount uint64
 }
 
-func newAvgRate(counter CountableFunc, samplingWindow time.Duration, period time.Duration, unit string) (*avgRate, error) {
+func newAvgRate(counter CountableFunc, samplingWindow time.Duration, period time.Duration, unit string, clock Clock) (*avgRate, error) {
+	return newFloatAvgRate(func() float64 { return float64(counter()) }, samplingWindow, period, unit, clock)
+}
+
+func newFloatAvgRate(counter floatCountableFunc, samplingWindow time.Duration, period time.Duration, unit string, clock Clock) (*avgRate, error) {
 	if samplingWindow == 0 {
 		return nil, fmt.Errorf("sampling window must be greater then 0")
 	}
@@ -133,31 +181,53 @@ func newAvgRate(counter CountableFunc, samplingWindow time.Duration, period time
 		samplingWindow: samplingWindow,
 		unit:           unit,
 		bucketCount:    bucketCount,
-		totals:         ring.New[uint64](int(bucketCount)),
+		clock:          clock,
+		totals:         ring.New[float64](int(bucketCount)),
 	}, nil
 }
 
-func (c *avgRate) Total() uint64      { return c.actualTotal }
+// Total returns the last sampled total, truncated for the sources having a
+// fractional total, see TotalFloat.
+func (c *avgRate) Total() uint64 {
+	return uint64(c.TotalFloat())
+}
+
+func (c *avgRate) TotalFloat() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.actualTotal
+}
 func (c *avgRate) Rate() float64      { return c.rate() }
 func (c *avgRate) RateString() string { return strconv.FormatFloat(c.Rate(), 'f', 3, 64) }
 func (c *avgRate) String() string {
-	return fmt.Sprintf("%s %s/%s (%d total)", c.RateString(), c.unit, timeUnitToString(c.samplingWindow), c.Total())
+	return fmt.Sprintf("%s %s/%s (%s total)", c.RateString(), c.unit, timeUnitToString(c.samplingWindow), strconv.FormatFloat(c.TotalFloat(), 'f', -1, 64))
 }
 func (c *avgRate) rate() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	skip := uint64(0)
 	if c.actualCount < uint64(c.bucketCount) {
 		// We do an extra minus one because we are interested about delta and there is always `c.bucketCount - 1` deltas
 		skip = c.bucketCount - c.actualCount - 1
 	}
 
-	var sum uint64
+	var sum float64
 	var deltaCount uint64
 	var valueCount uint64
-	var previousData *uint64
+	var previousData *float64
 
-	c.totals.Do(func(total uint64) {
+	c.totals.Do(func(total float64) {
 		if valueCount > skip && previousData != nil {
-			sum += total - *previousData
+			if total < *previousData {
+				if !c.decreaseAsNoProgress {
+					// The counter went backwards, it was reset and counted from zero since then
+					sum += total
+				}
+			} else {
+				sum += total - *previousData
+			}
 			deltaCount++
 		}
 
@@ -165,7 +235,7 @@ func (c *avgRate) rate() float64 {
 		valueCount++
 	})
 
-	return float64(sum) / float64(deltaCount)
+	return sum / float64(deltaCount)
 }
 
 // SyncNow forces a sync to retrieve the value(s) of the counter(s)
@@ -174,32 +244,67 @@ func (c *avgRate) rate() float64 {
 // This call is blocking until the sync is performed.
 func (c *avgRate) SyncNow() {
 	if c.janitor != nil {
-		select {
-		case c.janitor.wake <- true:
-		case <-c.janitor.stop:
-			return
-		}
-
-		// Block until the sync is performed (or janitor is stopped)
-		select {
-		case <-c.janitor.syncPerformed:
-		case <-c.janitor.stop:
-		}
+		c.janitor.forceSync()
 	}
 }
 
 func (c *avgRate) syncNow() {
+	// Retrieved outside of the lock, collecting the value might be slow
+	total := c.counterFunc()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.actualCount++
-	c.actualTotal = c.counterFunc()
+	c.actualTotal = total
 
 	c.totals.Value = c.actualTotal
 	c.totals = c.totals.Next()
 }
 
+// MarshalLogObject logs the `rate`, `total`, `unit`, `window_seconds` and
+// `period_seconds` fields, the rate being 0 until enough samples are taken.
+func (c *avgRate) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	rate := c.Rate()
+	if math.IsNaN(rate) {
+		rate = 0
+	}
+
+	enc.AddFloat64("rate", rate)
+	enc.AddFloat64("total", c.TotalFloat())
+	enc.AddString("unit", c.unit)
+	enc.AddFloat64("window_seconds", c.samplingWindow.Seconds())
+	enc.AddFloat64("period_seconds", c.period().Seconds())
+	return nil
+}
+
+func (c *avgRate) MarshalJSON() ([]byte, error) {
+	return marshalObjectJSON(c)
+}
+
+func (c *avgRate) period() time.Duration {
+	return time.Duration(c.bucketCount-1) * c.samplingWindow
+}
+
+// seed fills the window with the given total, so what was counted before the first
+// sample is not accounted as part of the rate.
+func (c *avgRate) seed(total float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.actualTotal = total
+	for i := uint64(0); i < c.bucketCount; i++ {
+		c.totals.Value = total
+		c.totals = c.totals.Next()
+	}
+}
+
 func (c *avgRate) getAvgRate() *avgRate {
 	return c
 }
 
+// janitor invokes its sync function at every sampling window from a background
+// goroutine, until shut down.
 type janitor struct {
 	samplingWindow time.Duration
 	wake           chan bool
@@ -208,15 +313,28 @@ type janitor struct {
 	once           *sync.Once
 }
 
-func (j *janitor) run(r *avgRate) {
-	ticker := time.NewTicker(j.samplingWindow)
+func newJanitor(samplingWindow time.Duration, clock Clock, syncFunc func()) *janitor {
+	j := &janitor{
+		samplingWindow: samplingWindow,
+		stop:           make(chan bool, 1),
+		wake:           make(chan bool, 1),
+		syncPerformed:  make(chan bool, 1),
+		once:           &sync.Once{},
+	}
+
+	// Created before the goroutine starts so no tick of a fake clock is missed
+	go j.run(syncFunc, clock.NewTicker(samplingWindow))
+
+	return j
+}
 
+func (j *janitor) run(syncFunc func(), ticker Ticker) {
 	for {
 		select {
-		case <-ticker.C:
-			r.syncNow()
+		case <-ticker.C():
+			syncFunc()
 		case <-j.wake:
-			r.syncNow()
+			syncFunc()
 
 			select {
 			case j.syncPerformed <- true:
@@ -230,27 +348,35 @@ func (j *janitor) run(r *avgRate) {
 	}
 }
 
-func stopJanitor(c avgRateCounter) {
-	j := c.getAvgRate().janitor
-
-	if j != nil {
-		j.once.Do(func() {
-			j.stop <- true
-			close(j.stop)
-			close(j.wake)
-		})
+// forceSync wakes the janitor up and blocks until the sync is performed
+func (j *janitor) forceSync() {
+	select {
+	case j.wake <- true:
+	case <-j.stop:
+		return
+	}
+
+	// Block until the sync is performed (or janitor is stopped)
+	select {
+	case <-j.syncPerformed:
+	case <-j.stop:
 	}
 }
 
-func runJanitor(r *avgRate, samplingWindow time.Duration) {
-	j := &janitor{
-		samplingWindow: samplingWindow,
-		stop:           make(chan bool, 1),
-		wake:           make(chan bool, 1),
-		syncPerformed:  make(chan bool, 1),
-		once:           &sync.Once{},
+func (j *janitor) shutdown() {
+	j.once.Do(func() {
+		j.stop <- true
+		close(j.stop)
+		close(j.wake)
+	})
+}
+
+func stopJanitor(c avgRateCounter) {
+	if j := c.getAvgRate().janitor; j != nil {
+		j.shutdown()
 	}
-	r.janitor = j
+}
 
-	go j.run(r)
+func runJanitor(r *avgRate, samplingWindow time.Duration) {
+	r.janitor = newJanitor(samplingWindow, r.clock, r.syncNow)
 }
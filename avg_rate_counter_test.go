@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -26,3 +27,134 @@ func TestAvgRateCounter(t *testing.T) {
 	// hard to make this accurate
 	//assert.Equal(t, "0.333 blocks/100ms (3 total)", r.String())
 }
+
+func TestAvgRateCounter_FakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+
+	r, err := NewAvgRateCounter(time.Second, 3*time.Second, "blocks", CounterClock(clock))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	for i, count := range []uint64{10, 3, 0, 7} {
+		r.Add(count)
+		clock.Advance(time.Second)
+		waitSamples(t, r.avgRate, uint64(i+1))
+	}
+
+	assert.Equal(t, "3.333 blocks/s (20 total)", r.String())
+
+	// The window moves, the first second falls out of the period
+	r.Add(2)
+	clock.Advance(time.Second)
+	waitSamples(t, r.avgRate, 5)
+	assert.Equal(t, 3.0, r.Rate())
+}
+
+func TestAvgRate_CounterReset(t *testing.T) {
+	var total uint64
+	r, err := newAvgRate(func() uint64 { return total }, time.Second, 3*time.Second, "blocks", NewFakeClock(time.Unix(0, 0)))
+	require.NoError(t, err)
+
+	// 20 -> 3 is a reset, the 3 events since then are counted from zero
+	for _, total = range []uint64{10, 20, 3, 8} {
+		r.syncNow()
+	}
+
+	assert.Equal(t, 6.0, r.Rate())
+}
+
+func TestAvgRateFromPromCounter_CounterReset(t *testing.T) {
+	blocks := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks"}, []string{"source"})
+
+	r, err := NewAvgRateFromPromCounter(blocks, time.Second, 3*time.Second, "blocks", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	blocks.WithLabelValues("node-1").Add(10)
+	blocks.WithLabelValues("node-2").Add(5)
+	r.SyncNow()
+
+	blocks.WithLabelValues("node-1").Add(2)
+	blocks.WithLabelValues("node-2").Add(1)
+	r.SyncNow()
+
+	// Deleting a series makes the sum go from 18 down to 12, node-1 made no progress
+	blocks.DeleteLabelValues("node-2")
+	r.SyncNow()
+
+	blocks.WithLabelValues("node-1").Add(3)
+	r.SyncNow()
+
+	// (3 + 0 + 3) / 3
+	assert.Equal(t, 2.0, r.Rate())
+	assert.Equal(t, 21.0, r.TotalFloat())
+
+	// A series restarting from zero is a reset of that series only
+	blocks.DeleteLabelValues("node-1")
+	blocks.WithLabelValues("node-1").Add(1)
+	r.SyncNow()
+
+	// (0 + 3 + 1) / 3
+	assert.InDelta(t, 4.0/3, r.Rate(), 0.0001)
+}
+
+func TestAvgRateFromPromGauge_CounterReset(t *testing.T) {
+	blocks := prometheus.NewGauge(prometheus.GaugeOpts{Name: "blocks"})
+
+	r, err := NewAvgRateFromPromGauge(blocks, time.Second, 3*time.Second, "blocks", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	for _, value := range []float64{100, 110, 5, 15} {
+		blocks.Set(value)
+		r.SyncNow()
+	}
+
+	assert.Equal(t, 25.0/3, r.Rate())
+}
+
+func TestAvgRateFromPromCounter_Fractional(t *testing.T) {
+	spent := prometheus.NewCounter(prometheus.CounterOpts{Name: "seconds_spent"})
+
+	r, err := NewAvgRateFromPromCounter(spent, time.Second, 3*time.Second, "seconds", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	for i := 0; i < 3; i++ {
+		spent.Add(0.25)
+		r.SyncNow()
+	}
+
+	assert.Equal(t, 0.25, r.Rate())
+	assert.Equal(t, 0.75, r.TotalFloat())
+	assert.Equal(t, uint64(0), r.Total())
+	assert.Equal(t, "0.250 seconds/s (0.75 total)", r.String())
+}
+
+func TestAvgRateFromPromGauge_Fractional(t *testing.T) {
+	gas := prometheus.NewGauge(prometheus.GaugeOpts{Name: "gas_gwei"})
+
+	r, err := NewAvgRateFromPromGauge(gas, time.Second, 2*time.Second, "gwei", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	for _, value := range []float64{0.5, 1.75, 2.5} {
+		gas.Set(value)
+		r.SyncNow()
+	}
+
+	assert.Equal(t, 1.0, r.Rate())
+	assert.Equal(t, uint64(2), r.Total())
+}
+
+// waitSamples waits until the janitor of the rate performed the expected number of samples
+func waitSamples(t *testing.T, r *avgRate, count uint64) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		return r.actualCount >= count
+	}, time.Second, time.Millisecond)
+}
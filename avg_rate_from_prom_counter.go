@@ -3,6 +3,7 @@ package dmetrics
 import (
 	"fmt"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -11,18 +12,76 @@ import (
 
 type avgRatePromCollector struct {
 	*avgRate
-	collector          prometheus.Collector
-	promMetricsToValue func(metrics []*dto.Metric) uint64
+	collector         prometheus.Collector
+	promMetricToValue func(metric *dto.Metric) (float64, bool)
+
+	// resets and total are only used by the janitor goroutine
+	resets *seriesResets
+	total  float64
 }
 
 func (c *avgRatePromCollector) Stop() {
 	stopJanitor(c)
 }
 
-func (a *avgRatePromCollector) count() uint64 {
+// count returns the increase of all the series since the first collection, the
+// resets being detected per series so a series restarting or being deleted does not
+// affect the others.
+func (a *avgRatePromCollector) count() float64 {
+	for _, metric := range collectMetrics(a.collector) {
+		if value, ok := a.promMetricToValue(metric); ok {
+			a.total += a.resets.increase(seriesID(metric), value)
+		}
+	}
+	a.resets.collected()
+
+	return a.total
+}
+
+// seriesResets tracks the last value of each series of a collector to compute their
+// increase from one collection to the next, like Prometheus `increase()` does.
+type seriesResets struct {
+	previous map[string]float64
+	current  map[string]float64
+}
+
+func newSeriesResets() *seriesResets {
+	return &seriesResets{previous: map[string]float64{}, current: map[string]float64{}}
+}
+
+// increase records the value of a series for the current collection and returns how
+// much it increased since the previous one. A decrease is a reset of the series, and
+// a series not seen in the previous collection is new, both being counted from zero.
+func (r *seriesResets) increase(series string, value float64) float64 {
+	r.current[series] = value
+
+	previous, found := r.previous[series]
+	if !found || value < previous {
+		return value
+	}
+
+	return value - previous
+}
+
+// collected ends the current collection, the series absent from it are forgotten.
+func (r *seriesResets) collected() {
+	r.previous, r.current = r.current, map[string]float64{}
+}
+
+// seriesID identifies a series by all its labels, which are sorted by name.
+func seriesID(metric *dto.Metric) string {
+	parts := make([]string, len(metric.Label))
+	for i, pair := range metric.Label {
+		parts[i] = pair.GetName() + "=" + pair.GetValue()
+	}
+
+	return strings.Join(parts, "\xff")
+}
+
+func collectMetrics(collector prometheus.Collector) []*dto.Metric {
 	metricChan := make(chan prometheus.Metric, 16)
 	go func() {
-		a.collector.Collect(metricChan)
+		collector.Collect(metricChan)
 		close(metricChan)
 	}()
 
@@ -37,10 +96,10 @@ func (a *avgRatePromCollector) count() uint64 {
 		metrics = append(metrics, model)
 	}
 
-	return a.promMetricsToValue(metrics)
+	return metrics
 }
 
-// *Important* This  handles `Vec` metrics by summing for all labels, extracting for one specific label or for all labels is not yet supported.
+// *Important* This  handles `Vec` metrics by summing for all labels, use [NewAvgRatesFromPromCounter] to track the rate of each label separately.
 
 type AvgRatePromCounter struct {
 	*avgRatePromCollector
@@ -48,8 +107,8 @@ type AvgRatePromCounter struct {
 
 // MustNewAvgRateFromPromCounter acts like [NewAvgRateFromPromCounter] but panics if an error occurs.
 // Refers to [NewAvgRateFromPromCounter] for more information.
-func MustNewAvgRateFromPromCounter(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string) *AvgRatePromCounter {
-	a, err := NewAvgRateFromPromCounter(promCollector, samplingWindow, period, unit)
+func MustNewAvgRateFromPromCounter(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRatePromCounter {
+	a, err := NewAvgRateFromPromCounter(promCollector, samplingWindow, period, unit, options...)
 	if err != nil {
 		panic(err)
 	}
@@ -78,14 +137,20 @@ func MustNewAvgRateFromPromCounter(promCollector prometheus.Collector, samplingW
 // then when the "window moves" you would get
 //
 //	(3 + 0 + 7)/4 = 3.333 blocks/sec
-func NewAvgRateFromPromCounter(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string) (*AvgRatePromCounter, error) {
-	a, err := newAvgRateFromPromCollector(promCollector, samplingWindow, period, unit, func(metrics []*dto.Metric) (sum uint64) {
-		for _, m := range metrics {
-			if m.Counter != nil && m.Counter.Value != nil {
-				sum += uint64(*m.Counter.Value)
-			}
+//
+// Like Prometheus `rate()`, a decrease of a series is treated as a counter reset,
+// the new value being counted from zero. Resets are detected per series, a series of
+// a `Vec` being deleted only stops counting. The total is thus the increase of all
+// the series since the creation, not the sum of their current values.
+//
+// Fractional values, like seconds spent, are kept as is, use `TotalFloat` to
+// retrieve the total without truncation.
+func NewAvgRateFromPromCounter(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRatePromCounter, error) {
+	a, err := newAvgRateFromPromCollector(promCollector, samplingWindow, period, unit, newCounterOptions(options), func(m *dto.Metric) (float64, bool) {
+		if m.Counter != nil && m.Counter.Value != nil {
+			return *m.Counter.Value, true
 		}
-		return
+		return 0, false
 	})
 	if err != nil {
 		return nil, err
@@ -100,8 +165,8 @@ type AvgRatePromGauge struct {
 
 // MustNewAvgRateFromPromGauge acts like [NewAvgRateFromPromGauge] but panics if an error occurs.
 // Refers to [NewAvgRateFromPromGauge] for more information.
-func MustNewAvgRateFromPromGauge(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string) *AvgRatePromGauge {
-	a, err := NewAvgRateFromPromGauge(promCollector, samplingWindow, period, unit)
+func MustNewAvgRateFromPromGauge(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRatePromGauge {
+	a, err := NewAvgRateFromPromGauge(promCollector, samplingWindow, period, unit, options...)
 	if err != nil {
 		panic(err)
 	}
@@ -131,15 +196,15 @@ func MustNewAvgRateFromPromGauge(promCollector prometheus.Collector, samplingWin
 //
 //	(3 + 0 + 7)/4 = 3.333 blocks/sec
 //
-// **Important** Your Gauge should be ever increasing. If it's not, the results will be incorrect.
-func NewAvgRateFromPromGauge(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string) (*AvgRatePromGauge, error) {
-	a, err := newAvgRateFromPromCollector(promCollector, samplingWindow, period, unit, func(metrics []*dto.Metric) (sum uint64) {
-		for _, m := range metrics {
-			if m.Gauge != nil && m.Gauge.Value != nil {
-				sum += uint64(*m.Gauge.Value)
-			}
+// **Important** Your Gauge should be ever increasing. A decrease is treated as a
+// counter reset, the new value being counted from zero like Prometheus `rate()` does,
+// see [NewAvgRateFromPromCounter] for details.
+func NewAvgRateFromPromGauge(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRatePromGauge, error) {
+	a, err := newAvgRateFromPromCollector(promCollector, samplingWindow, period, unit, newCounterOptions(options), func(m *dto.Metric) (float64, bool) {
+		if m.Gauge != nil && m.Gauge.Value != nil {
+			return *m.Gauge.Value, true
 		}
-		return
+		return 0, false
 	})
 	if err != nil {
 		return nil, err
@@ -153,10 +218,11 @@ func newAvgRateFromPromCollector(
 	samplingWindow time.Duration,
 	period time.Duration,
 	unit string,
-	promMetricsToValue func(metrics []*dto.Metric) uint64,
+	options counterOptions,
+	promMetricToValue func(metric *dto.Metric) (float64, bool),
 ) (*avgRatePromCollector, error) {
-	a := &avgRatePromCollector{collector: promCollector, promMetricsToValue: promMetricsToValue}
-	avgRage, err := newAvgRate(a.count, samplingWindow, period, unit)
+	a := &avgRatePromCollector{collector: promCollector, promMetricToValue: promMetricToValue, resets: newSeriesResets()}
+	avgRage, err := newFloatAvgRate(a.count, samplingWindow, period, unit, options.clock)
 	if err != nil {
 		return nil, fmt.Errorf("new avg rate counter: %w", err)
 	}
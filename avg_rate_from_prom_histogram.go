@@ -0,0 +1,213 @@
+package dmetrics
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// AvgRatePromObservations tracks the average rate of the observations made on a
+// Prometheus Histogram or Summary, see [NewAvgRateFromPromObservationCount] and
+// [NewAvgRateFromPromObservationSum].
+type AvgRatePromObservations struct {
+	*avgRatePromCollector
+}
+
+// MustNewAvgRateFromPromObservationCount acts like [NewAvgRateFromPromObservationCount] but panics if an error occurs.
+func MustNewAvgRateFromPromObservationCount(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRatePromObservations {
+	a, err := NewAvgRateFromPromObservationCount(promCollector, samplingWindow, period, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAvgRateFromPromObservationCount extracts the average rate of observations, the
+// `_count` of a Prometheus Histogram or Summary, over a period of time. It has the
+// same sampling window and period semantics as [NewAvgRateFromPromCounter], `Vec`
+// metrics being summed for all labels and resets being detected per series.
+//
+// ```
+// rate := dmetrics.MustNewAvgRateFromPromObservationCount(requestDuration, time.Second, time.Minute, "requests")
+//
+// rate.String() == 12.500 requests/s (7281 total)
+// ```
+func NewAvgRateFromPromObservationCount(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRatePromObservations, error) {
+	a, err := newAvgRateFromPromCollector(promCollector, samplingWindow, period, unit, newCounterOptions(options), observationCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AvgRatePromObservations{a}, nil
+}
+
+// MustNewAvgRateFromPromObservationSum acts like [NewAvgRateFromPromObservationSum] but panics if an error occurs.
+func MustNewAvgRateFromPromObservationSum(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRatePromObservations {
+	a, err := NewAvgRateFromPromObservationSum(promCollector, samplingWindow, period, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAvgRateFromPromObservationSum extracts the average rate of the observed values,
+// the `_sum` of a Prometheus Histogram or Summary, over a period of time. For a
+// request duration histogram, it is the number of seconds spent serving requests
+// per sampling window. See [NewAvgRateFromPromObservationCount] for details.
+func NewAvgRateFromPromObservationSum(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRatePromObservations, error) {
+	a, err := newAvgRateFromPromCollector(promCollector, samplingWindow, period, unit, newCounterOptions(options), observationSum)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AvgRatePromObservations{a}, nil
+}
+
+// AvgPromObservedValue tracks the mean of the values observed on a Prometheus
+// Histogram or Summary over a period of time, see [NewAvgObservedValueFromProm].
+type AvgPromObservedValue struct {
+	*avgPromObservedValue
+}
+
+// avgPromObservedValue is referenced by the janitor goroutine, the finalizer set on
+// the [AvgPromObservedValue] wrapping it stops the janitor once it is garbage collected.
+type avgPromObservedValue struct {
+	collector prometheus.Collector
+	period    time.Duration
+	unit      string
+	janitor   *janitor
+
+	count *avgRate
+	sum   *avgRate
+
+	// the totals are the increases since the first collection, the totals and resets
+	// being only used by the janitor goroutine
+	totalCount  float64
+	totalSum    float64
+	countResets *seriesResets
+	sumResets   *seriesResets
+}
+
+// MustNewAvgObservedValueFromProm acts like [NewAvgObservedValueFromProm] but panics if an error occurs.
+func MustNewAvgObservedValueFromProm(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgPromObservedValue {
+	a, err := NewAvgObservedValueFromProm(promCollector, samplingWindow, period, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAvgObservedValueFromProm extracts the mean of the values observed on a
+// Prometheus Histogram or Summary over a period of time, that is the `_sum` divided
+// by the `_count` of the observations made during the <period>. The `_sum` and
+// `_count` are both sampled at every <samplingWindow>, with the same semantics as
+// [NewAvgRateFromPromCounter].
+//
+// ```
+// latency := dmetrics.MustNewAvgObservedValueFromProm(requestDuration, time.Second, time.Minute, "seconds")
+//
+// latency.String() == avg 0.125 seconds (in the last 1m0s)
+// ```
+func NewAvgObservedValueFromProm(promCollector prometheus.Collector, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgPromObservedValue, error) {
+	clock := newCounterOptions(options).clock
+	a := &avgPromObservedValue{
+		collector:   promCollector,
+		period:      period,
+		unit:        unit,
+		countResets: newSeriesResets(),
+		sumResets:   newSeriesResets(),
+	}
+
+	var err error
+	if a.count, err = newFloatAvgRate(func() float64 { return a.totalCount }, samplingWindow, period, unit, clock); err != nil {
+		return nil, fmt.Errorf("new observation count rate: %w", err)
+	}
+
+	if a.sum, err = newFloatAvgRate(func() float64 { return a.totalSum }, samplingWindow, period, unit, clock); err != nil {
+		return nil, fmt.Errorf("new observation sum rate: %w", err)
+	}
+
+	a.janitor = newJanitor(samplingWindow, clock, a.syncNow)
+
+	out := &AvgPromObservedValue{a}
+	runtime.SetFinalizer(out, (*AvgPromObservedValue).Stop)
+
+	return out, nil
+}
+
+// Mean returns the mean of the values observed during the period, NaN while not
+// enough samples were taken or if nothing was observed.
+func (a *avgPromObservedValue) Mean() float64 {
+	count := a.count.Rate()
+	if count == 0 {
+		return math.NaN()
+	}
+
+	return a.sum.Rate() / count
+}
+
+func (a *avgPromObservedValue) MeanString() string {
+	return strconv.FormatFloat(a.Mean(), 'f', 3, 64)
+}
+
+func (a *avgPromObservedValue) String() string {
+	return fmt.Sprintf("avg %s %s (in the last %s)", a.MeanString(), a.unit, samplingWindowToString(a.period))
+}
+
+// SyncNow forces a sample to be taken right away, blocking until it is.
+func (a *avgPromObservedValue) SyncNow() {
+	a.janitor.forceSync()
+}
+
+func (a *avgPromObservedValue) Stop() {
+	a.janitor.shutdown()
+}
+
+// syncNow collects once so the count and the sum are sampled consistently
+func (a *avgPromObservedValue) syncNow() {
+	for _, metric := range collectMetrics(a.collector) {
+		id := seriesID(metric)
+		if count, ok := observationCount(metric); ok {
+			a.totalCount += a.countResets.increase(id, count)
+		}
+		if sum, ok := observationSum(metric); ok {
+			a.totalSum += a.sumResets.increase(id, sum)
+		}
+	}
+	a.countResets.collected()
+	a.sumResets.collected()
+
+	a.count.syncNow()
+	a.sum.syncNow()
+}
+
+// observationCount returns the `_count` of a Histogram or Summary metric, the other
+// kinds of metrics are ignored.
+func observationCount(m *dto.Metric) (float64, bool) {
+	switch {
+	case m.Histogram != nil:
+		return float64(m.Histogram.GetSampleCount()), true
+	case m.Summary != nil:
+		return float64(m.Summary.GetSampleCount()), true
+	}
+
+	return 0, false
+}
+
+// observationSum returns the `_sum` of a Histogram or Summary metric, the other
+// kinds of metrics are ignored.
+func observationSum(m *dto.Metric) (float64, bool) {
+	switch {
+	case m.Histogram != nil:
+		return m.Histogram.GetSampleSum(), true
+	case m.Summary != nil:
+		return m.Summary.GetSampleSum(), true
+	}
+
+	return 0, false
+}
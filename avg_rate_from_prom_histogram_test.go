@@ -0,0 +1,119 @@
+package dmetrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvgRateFromPromObservations_Histogram(t *testing.T) {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "request_duration_seconds"}, []string{"method"})
+
+	count, err := NewAvgRateFromPromObservationCount(duration, time.Second, 2*time.Second, "requests", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer count.Stop()
+
+	sum, err := NewAvgRateFromPromObservationSum(duration, time.Second, 2*time.Second, "seconds", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer sum.Stop()
+
+	for _, observations := range [][]float64{{0.5, 1.5}, {0.25, 0.25, 0.5, 1}, {2}} {
+		for _, observation := range observations {
+			duration.WithLabelValues("get").Observe(observation)
+		}
+		duration.WithLabelValues("post").Observe(1)
+
+		count.SyncNow()
+		sum.SyncNow()
+	}
+
+	// Over the last two windows: 5 then 2 observations, 3 seconds observed in each
+	assert.Equal(t, 3.5, count.Rate())
+	assert.Equal(t, "3.500 requests/s (10 total)", count.String())
+	assert.Equal(t, 3.0, sum.Rate())
+	assert.Equal(t, 9.0, sum.TotalFloat())
+}
+
+func TestAvgRateFromPromObservations_Summary(t *testing.T) {
+	size := prometheus.NewSummary(prometheus.SummaryOpts{Name: "payload_bytes"})
+
+	count, err := NewAvgRateFromPromObservationCount(size, time.Second, time.Second, "payloads", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer count.Stop()
+
+	size.Observe(100)
+	count.SyncNow()
+	size.Observe(200)
+	size.Observe(300)
+	count.SyncNow()
+
+	assert.Equal(t, 2.0, count.Rate())
+}
+
+func TestAvgObservedValueFromProm(t *testing.T) {
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "request_duration_seconds"})
+
+	latency, err := NewAvgObservedValueFromProm(duration, time.Second, 2*time.Second, "seconds", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer latency.Stop()
+
+	latency.SyncNow()
+	assert.True(t, math.IsNaN(latency.Mean()), "nothing observed yet")
+
+	for _, observations := range [][]float64{{10, 10}, {0.5, 1.5}, {0.25, 0.75}} {
+		for _, observation := range observations {
+			duration.Observe(observation)
+		}
+		latency.SyncNow()
+	}
+
+	// The first window fell out of the period
+	assert.Equal(t, 0.75, latency.Mean())
+	assert.Equal(t, "avg 0.750 seconds (in the last 2s)", latency.String())
+
+	// Nothing observed during the whole period
+	latency.SyncNow()
+	latency.SyncNow()
+	assert.True(t, math.IsNaN(latency.Mean()))
+}
+
+func TestAvgObservedValueFromProm_Summary(t *testing.T) {
+	size := prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "payload_bytes"}, []string{"kind"})
+
+	avgSize, err := NewAvgObservedValueFromProm(size, time.Second, time.Second, "bytes", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer avgSize.Stop()
+
+	avgSize.SyncNow()
+	size.WithLabelValues("block").Observe(300)
+	size.WithLabelValues("trx").Observe(100)
+	avgSize.SyncNow()
+
+	assert.Equal(t, 200.0, avgSize.Mean())
+}
+
+func TestAvgObservedValueFromProm_DeletedSeries(t *testing.T) {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "request_duration_seconds"}, []string{"method"})
+
+	latency, err := NewAvgObservedValueFromProm(duration, time.Second, 2*time.Second, "seconds", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer latency.Stop()
+
+	duration.WithLabelValues("get").Observe(1)
+	duration.WithLabelValues("post").Observe(3)
+	latency.SyncNow()
+
+	duration.WithLabelValues("get").Observe(1)
+	latency.SyncNow()
+
+	// The other series are not affected by the deleted one
+	duration.DeleteLabelValues("post")
+	duration.WithLabelValues("get").Observe(1)
+	latency.SyncNow()
+
+	assert.Equal(t, 1.0, latency.Mean())
+}
@@ -0,0 +1,308 @@
+package dmetrics
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// AvgRatesPromVec tracks the average rate of a Prometheus Vec metric separately for
+// each combination of values of the tracked labels, see [NewAvgRatesFromPromCounter].
+type AvgRatesPromVec struct {
+	*avgRatesPromVec
+}
+
+// avgRatesPromVec is referenced by the janitor goroutine, the finalizer set on the
+// [AvgRatesPromVec] wrapping it stops the janitor once it is garbage collected.
+type avgRatesPromVec struct {
+	collector         prometheus.Collector
+	labels            []string
+	samplingWindow    time.Duration
+	period            time.Duration
+	unit              string
+	clock             Clock
+	promMetricToValue func(metric *dto.Metric) (float64, bool)
+	janitor           *janitor
+	maxAbsentSamples  uint64
+	defaultStringTopN int
+
+	lock   sync.RWMutex
+	series map[string]*labeledRate
+
+	// totals hold the increase of the series of each combination of label values since
+	// they are tracked, the totals and resets being only used by the janitor goroutine
+	totals map[string]float64
+	resets *seriesResets
+}
+
+type labeledRate struct {
+	values  []string
+	rate    *avgRate
+	absents uint64
+}
+
+// MustNewAvgRatesFromPromCounter acts like [NewAvgRatesFromPromCounter] but panics if an error occurs.
+func MustNewAvgRatesFromPromCounter(promCollector prometheus.Collector, labels []string, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRatesPromVec {
+	a, err := NewAvgRatesFromPromCounter(promCollector, labels, samplingWindow, period, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAvgRatesFromPromCounter acts like [NewAvgRateFromPromCounter] but tracks the
+// rate separately for each combination of values of the given labels, the series
+// sharing the same values for those labels being summed. For example, the block
+// rate per `source` of a `blocks{source, chain}` counter:
+//
+// ```
+// rates := dmetrics.MustNewAvgRatesFromPromCounter(blocksCounter, []string{"source"}, time.Second, 30*time.Second, "blocks")
+// rates.RateFor("node-1")
+//
+// rates.String() == source=node-1 12.000 blocks/s, source=node-2 3.000 blocks/s
+// ```
+//
+// Series appearing after the creation are tracked from their first sample. Series
+// disappearing are considered idle, and stop being tracked once they were absent
+// for a whole period. Like [NewAvgRateFromPromCounter], resets are detected for each
+// of the summed series.
+func NewAvgRatesFromPromCounter(promCollector prometheus.Collector, labels []string, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRatesPromVec, error) {
+	return newAvgRatesFromPromVec(promCollector, labels, samplingWindow, period, unit, newCounterOptions(options), func(m *dto.Metric) (float64, bool) {
+		if m.Counter != nil && m.Counter.Value != nil {
+			return *m.Counter.Value, true
+		}
+		return 0, false
+	})
+}
+
+// MustNewAvgRatesFromPromGauge acts like [NewAvgRatesFromPromGauge] but panics if an error occurs.
+func MustNewAvgRatesFromPromGauge(promCollector prometheus.Collector, labels []string, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRatesPromVec {
+	a, err := NewAvgRatesFromPromGauge(promCollector, labels, samplingWindow, period, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAvgRatesFromPromGauge acts like [NewAvgRatesFromPromCounter] but for an ever
+// increasing Prometheus Gauge Vec.
+func NewAvgRatesFromPromGauge(promCollector prometheus.Collector, labels []string, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRatesPromVec, error) {
+	return newAvgRatesFromPromVec(promCollector, labels, samplingWindow, period, unit, newCounterOptions(options), func(m *dto.Metric) (float64, bool) {
+		if m.Gauge != nil && m.Gauge.Value != nil {
+			return *m.Gauge.Value, true
+		}
+		return 0, false
+	})
+}
+
+func newAvgRatesFromPromVec(
+	promCollector prometheus.Collector,
+	labels []string,
+	samplingWindow time.Duration,
+	period time.Duration,
+	unit string,
+	options counterOptions,
+	promMetricToValue func(metric *dto.Metric) (float64, bool),
+) (*AvgRatesPromVec, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("at least one label is required")
+	}
+
+	// Validates the parameters once, the same ones are used for every series
+	if _, err := newFloatAvgRate(nil, samplingWindow, period, unit, options.clock); err != nil {
+		return nil, fmt.Errorf("new avg rates: %w", err)
+	}
+
+	a := &avgRatesPromVec{
+		collector:         promCollector,
+		labels:            labels,
+		samplingWindow:    samplingWindow,
+		period:            period,
+		unit:              unit,
+		clock:             options.clock,
+		promMetricToValue: promMetricToValue,
+		maxAbsentSamples:  uint64(period / samplingWindow),
+		defaultStringTopN: 5,
+		series:            map[string]*labeledRate{},
+		totals:            map[string]float64{},
+		resets:            newSeriesResets(),
+	}
+	a.janitor = newJanitor(samplingWindow, options.clock, a.syncNow)
+
+	out := &AvgRatesPromVec{a}
+	runtime.SetFinalizer(out, (*AvgRatesPromVec).Stop)
+
+	return out, nil
+}
+
+// RateFor returns the average rate of the series having the given label values, in
+// the order the labels were given at creation. It returns 0 for an unknown series
+// or while not enough samples were taken.
+func (a *avgRatesPromVec) RateFor(values ...string) float64 {
+	a.lock.RLock()
+	series, found := a.series[seriesKey(values)]
+	a.lock.RUnlock()
+
+	if !found {
+		return 0
+	}
+
+	return rateOrZero(series.rate)
+}
+
+// Rates returns the average rate of every tracked series, keyed by their label
+// values joined with a comma.
+func (a *avgRatesPromVec) Rates() map[string]float64 {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	out := make(map[string]float64, len(a.series))
+	for _, series := range a.series {
+		out[strings.Join(series.values, ",")] = rateOrZero(series.rate)
+	}
+
+	return out
+}
+
+// SyncNow forces a sample to be taken right away, blocking until it is.
+func (a *avgRatesPromVec) SyncNow() {
+	a.janitor.forceSync()
+}
+
+func (a *avgRatesPromVec) Stop() {
+	a.janitor.shutdown()
+}
+
+func (a *avgRatesPromVec) String() string {
+	return a.StringTop(a.defaultStringTopN)
+}
+
+// StringTop lists the rate of the N series with the highest rates.
+func (a *avgRatesPromVec) StringTop(n int) string {
+	type entry struct {
+		values []string
+		rate   float64
+	}
+
+	a.lock.RLock()
+	entries := make([]entry, 0, len(a.series))
+	for _, series := range a.series {
+		entries = append(entries, entry{series.values, rateOrZero(series.rate)})
+	}
+	a.lock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].rate != entries[j].rate {
+			return entries[i].rate > entries[j].rate
+		}
+		return strings.Join(entries[i].values, ",") < strings.Join(entries[j].values, ",")
+	})
+
+	if len(entries) == 0 {
+		return fmt.Sprintf("no %s", a.unit)
+	}
+
+	parts := make([]string, 0, n+1)
+	for i, e := range entries {
+		if i == n {
+			parts = append(parts, fmt.Sprintf("(%d more)", len(entries)-n))
+			break
+		}
+
+		labels := make([]string, len(a.labels))
+		for j, label := range a.labels {
+			labels[j] = label + "=" + e.values[j]
+		}
+
+		parts = append(parts, fmt.Sprintf("%s %s %s/%s", strings.Join(labels, ","), strconv.FormatFloat(e.rate, 'f', 3, 64), a.unit, timeUnitToString(a.samplingWindow)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (a *avgRatesPromVec) syncNow() {
+	valuesByKey := map[string][]string{}
+	for _, metric := range collectMetrics(a.collector) {
+		value, ok := a.promMetricToValue(metric)
+		if !ok {
+			continue
+		}
+
+		values := labelValues(metric, a.labels)
+		key := seriesKey(values)
+		a.totals[key] += a.resets.increase(seriesID(metric), value)
+		valuesByKey[key] = values
+	}
+	a.resets.collected()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// New series are seeded with their first total, which is the base of their rate
+	seeded := map[string]bool{}
+	for key, values := range valuesByKey {
+		if _, found := a.series[key]; !found {
+			key := key
+			rate, _ := newFloatAvgRate(func() float64 { return a.totals[key] }, a.samplingWindow, a.period, a.unit, a.clock)
+			rate.seed(a.totals[key])
+			a.series[key] = &labeledRate{values: values, rate: rate}
+			seeded[key] = true
+		}
+	}
+
+	// Absent series keep their last total, making no progress, until they are dropped
+	for key, series := range a.series {
+		if _, found := valuesByKey[key]; found {
+			series.absents = 0
+			continue
+		}
+
+		series.absents++
+		if series.absents > a.maxAbsentSamples {
+			delete(a.series, key)
+			delete(a.totals, key)
+		}
+	}
+
+	for key, series := range a.series {
+		if !seeded[key] {
+			series.rate.syncNow()
+		}
+	}
+}
+
+func labelValues(metric *dto.Metric, labels []string) []string {
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		for _, pair := range metric.Label {
+			if pair.GetName() == label {
+				values[i] = pair.GetValue()
+				break
+			}
+		}
+	}
+
+	return values
+}
+
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func rateOrZero(rate *avgRate) float64 {
+	// NaN while not enough samples were taken
+	value := rate.Rate()
+	if math.IsNaN(value) {
+		return 0
+	}
+
+	return value
+}
@@ -0,0 +1,103 @@
+package dmetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvgRatesFromPromCounter(t *testing.T) {
+	blocks := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks"}, []string{"source", "chain"})
+
+	rates, err := NewAvgRatesFromPromCounter(blocks, []string{"source"}, time.Second, 3*time.Second, "blocks", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer rates.Stop()
+
+	assert.Equal(t, "no blocks", rates.String())
+
+	rates.SyncNow()
+	for i := 0; i < 3; i++ {
+		blocks.WithLabelValues("node-1", "ethereum").Add(2)
+		blocks.WithLabelValues("node-1", "polygon").Add(4)
+		blocks.WithLabelValues("node-2", "ethereum").Add(1)
+		rates.SyncNow()
+	}
+
+	// Series sharing the same source are summed
+	assert.Equal(t, 6.0, rates.RateFor("node-1"))
+	assert.Equal(t, 1.0, rates.RateFor("node-2"))
+	assert.Equal(t, 0.0, rates.RateFor("node-3"))
+	assert.Equal(t, map[string]float64{"node-1": 6, "node-2": 1}, rates.Rates())
+	assert.Equal(t, "source=node-1 6.000 blocks/s, source=node-2 1.000 blocks/s", rates.String())
+	assert.Equal(t, "source=node-1 6.000 blocks/s, (1 more)", rates.StringTop(1))
+}
+
+func TestAvgRatesFromPromCounter_AppearingAndDisappearingSeries(t *testing.T) {
+	blocks := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks"}, []string{"source"})
+
+	rates, err := NewAvgRatesFromPromCounter(blocks, []string{"source"}, time.Second, 3*time.Second, "blocks", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer rates.Stop()
+
+	blocks.WithLabelValues("node-1").Add(100)
+	rates.SyncNow()
+	blocks.WithLabelValues("node-1").Add(3)
+	rates.SyncNow()
+
+	// Tracked from its first sample, what was counted before is not part of the rate
+	blocks.WithLabelValues("node-2").Add(50)
+	rates.SyncNow()
+	blocks.WithLabelValues("node-2").Add(5)
+	rates.SyncNow()
+
+	assert.Equal(t, 5.0, rates.RateFor("node-2"))
+
+	// An absent series makes no progress, then is dropped after a whole period
+	blocks.DeleteLabelValues("node-1")
+	rates.SyncNow()
+	assert.Contains(t, rates.Rates(), "node-1")
+
+	rates.SyncNow()
+	rates.SyncNow()
+	assert.Contains(t, rates.Rates(), "node-1")
+	assert.Equal(t, 0.0, rates.RateFor("node-1"))
+
+	rates.SyncNow()
+	assert.NotContains(t, rates.Rates(), "node-1")
+	assert.Contains(t, rates.Rates(), "node-2")
+}
+
+func TestAvgRatesFromPromCounter_Validation(t *testing.T) {
+	blocks := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks"}, []string{"source"})
+
+	_, err := NewAvgRatesFromPromCounter(blocks, nil, time.Second, 3*time.Second, "blocks")
+	assert.EqualError(t, err, "at least one label is required")
+
+	_, err = NewAvgRatesFromPromCounter(blocks, []string{"source"}, 3*time.Second, time.Second, "blocks")
+	assert.Error(t, err)
+}
+
+func TestAvgRatesFromPromCounter_CounterReset(t *testing.T) {
+	blocks := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks"}, []string{"source"})
+
+	rates, err := NewAvgRatesFromPromCounter(blocks, []string{"source"}, time.Second, 3*time.Second, "blocks", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	require.NoError(t, err)
+	defer rates.Stop()
+
+	blocks.WithLabelValues("node-1").Add(100)
+	rates.SyncNow()
+	blocks.WithLabelValues("node-1").Add(4)
+	rates.SyncNow()
+
+	// The series restarts from zero before being dropped
+	blocks.DeleteLabelValues("node-1")
+	blocks.WithLabelValues("node-1").Add(2)
+	rates.SyncNow()
+	blocks.WithLabelValues("node-1").Add(3)
+	rates.SyncNow()
+
+	assert.Equal(t, 3.0, rates.RateFor("node-1"))
+}
@@ -0,0 +1,197 @@
+package dmetrics
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+var _ prometheus.Collector = (*CatchUpTracker)(nil)
+
+// CatchUpTracker tracks how far behind a reference head (e.g. the network tip as seen
+// by another source) the processed block is, and estimates when it will catch up.
+// It exposes the `blocks_behind`, `catch_up_blocks_per_second` and
+// `catch_up_eta_seconds` gauges, prefixed like every other metric of the Set, and
+// is registered with the Set.
+//
+// The processing and reference head rates are averaged over the period using the
+// same machinery as [AvgRateCounter], the estimate being based on the rate at which
+// the processed block closes the gap with the reference head. When the gap is not
+// closing, the estimated time is `+Inf`.
+//
+// ```
+// catchUp := metricSet.MustNewCatchUpTracker(time.Second, 30*time.Second)
+// defer catchUp.Stop()
+//
+// catchUp.SetReferenceHead(tip.Number)
+// catchUp.SetProcessedBlock(block.Number)
+//
+// zlog.Info("progress", zap.Stringer("catch_up", catchUp))
+// // 1200 blocks behind, processing 25.000 blocks/s, caught up in 1m0s
+// ```
+type CatchUpTracker struct {
+	processed     *atomic.Uint64
+	referenceHead *atomic.Uint64
+
+	// seeded flags are set once the first block number was recorded, see [avgRate.seed]
+	processedSeeded *atomic.Bool
+	headSeeded      *atomic.Bool
+
+	processedRate *avgRate
+	headRate      *avgRate
+
+	behindGauge prometheus.Gauge
+	rateGauge   prometheus.Gauge
+	etaGauge    prometheus.Gauge
+}
+
+// MustNewCatchUpTracker acts like [Set.NewCatchUpTracker] but panics if an error occurs.
+func (s *Set) MustNewCatchUpTracker(samplingWindow time.Duration, period time.Duration, options ...CounterOption) *CatchUpTracker {
+	t, err := s.NewCatchUpTracker(samplingWindow, period, options...)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// NewCatchUpTracker creates a [CatchUpTracker] whose rates are sampled at every
+// `samplingWindow` and averaged over `period`, see [NewAvgRateCounter] for details.
+func (s *Set) NewCatchUpTracker(samplingWindow time.Duration, period time.Duration, options ...CounterOption) (*CatchUpTracker, error) {
+	clock := newCounterOptions(options).clock
+
+	t := &CatchUpTracker{
+		processed:       atomic.NewUint64(0),
+		referenceHead:   atomic.NewUint64(0),
+		processedSeeded: atomic.NewBool(false),
+		headSeeded:      atomic.NewBool(false),
+		behindGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: s.computeMetricName("blocks_behind"),
+			Help: "Number of blocks the processed block is behind the reference head",
+		}),
+		rateGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: s.computeMetricName("catch_up_blocks_per_second"),
+			Help: "Average number of blocks processed per second",
+		}),
+		etaGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: s.computeMetricName("catch_up_eta_seconds"),
+			Help: "Estimated number of seconds before the processed block catches up with the reference head, +Inf if not catching up",
+		}),
+	}
+
+	var err error
+	if t.processedRate, err = newAvgRate(t.processed.Load, samplingWindow, period, "blocks", clock); err != nil {
+		return nil, fmt.Errorf("new processed rate: %w", err)
+	}
+
+	if t.headRate, err = newAvgRate(t.referenceHead.Load, samplingWindow, period, "blocks", clock); err != nil {
+		return nil, fmt.Errorf("new reference head rate: %w", err)
+	}
+
+	// Heights go backwards on a reorg, which is not a counter reset
+	t.processedRate.decreaseAsNoProgress = true
+	t.headRate.decreaseAsNoProgress = true
+
+	runJanitor(t.processedRate, samplingWindow)
+	runJanitor(t.headRate, samplingWindow)
+
+	return s.add(t).(*CatchUpTracker), nil
+}
+
+// SetProcessedBlock records the number of the last processed block. The first
+// number recorded is the starting point of the rate, it is not counted as processed.
+func (t *CatchUpTracker) SetProcessedBlock(number uint64) {
+	t.processed.Store(number)
+	if t.processedSeeded.CAS(false, true) {
+		t.processedRate.seed(float64(t.processed.Load()))
+	}
+}
+
+// SetReferenceHead records the number of the reference head block. The first number
+// recorded is the starting point of the rate, it is not counted as a head progression.
+func (t *CatchUpTracker) SetReferenceHead(number uint64) {
+	t.referenceHead.Store(number)
+	if t.headSeeded.CAS(false, true) {
+		t.headRate.seed(float64(t.referenceHead.Load()))
+	}
+}
+
+// BlocksBehind returns how many blocks the processed block is behind the reference
+// head, 0 if it is at or past the reference head.
+func (t *CatchUpTracker) BlocksBehind() uint64 {
+	processed, head := t.processed.Load(), t.referenceHead.Load()
+	if processed >= head {
+		return 0
+	}
+
+	return head - processed
+}
+
+// Rate returns the average number of blocks processed per second.
+func (t *CatchUpTracker) Rate() float64 {
+	return perSecond(t.processedRate)
+}
+
+// ETA returns the estimated time before the processed block catches up with the
+// reference head, false if the gap is not closing.
+func (t *CatchUpTracker) ETA() (time.Duration, bool) {
+	behind := t.BlocksBehind()
+	if behind == 0 {
+		return 0, true
+	}
+
+	closingRate := t.Rate() - perSecond(t.headRate)
+	if !(closingRate > 0) {
+		return 0, false
+	}
+
+	return time.Duration(float64(behind) / closingRate * float64(time.Second)), true
+}
+
+// Stop stops the background sampling of the rates.
+func (t *CatchUpTracker) Stop() {
+	stopJanitor(t.processedRate)
+	stopJanitor(t.headRate)
+}
+
+func (t *CatchUpTracker) String() string {
+	eta := "not catching up"
+	if duration, ok := t.ETA(); ok {
+		eta = "caught up in " + duration.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("%d blocks behind, processing %.3f blocks/s, %s", t.BlocksBehind(), t.Rate(), eta)
+}
+
+func (t *CatchUpTracker) Describe(in chan<- *prometheus.Desc) {
+	t.behindGauge.Describe(in)
+	t.rateGauge.Describe(in)
+	t.etaGauge.Describe(in)
+}
+
+func (t *CatchUpTracker) Collect(in chan<- prometheus.Metric) {
+	t.behindGauge.Set(float64(t.BlocksBehind()))
+	t.rateGauge.Set(t.Rate())
+	if eta, ok := t.ETA(); ok {
+		t.etaGauge.Set(eta.Seconds())
+	} else {
+		t.etaGauge.Set(math.Inf(1))
+	}
+
+	t.behindGauge.Collect(in)
+	t.rateGauge.Collect(in)
+	t.etaGauge.Collect(in)
+}
+
+// perSecond returns the rate normalized per second, 0 while not enough samples were
+// taken to compute it.
+func perSecond(rate *avgRate) float64 {
+	value := rate.Rate()
+	if math.IsNaN(value) {
+		return 0
+	}
+
+	return value / rate.samplingWindow.Seconds()
+}
@@ -0,0 +1,151 @@
+package dmetrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatchUpTracker(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	set := NewSet()
+	catchUp := set.MustNewCatchUpTracker(time.Second, 2*time.Second, CounterClock(clock))
+	defer catchUp.Stop()
+
+	_, ok := catchUp.ETA()
+	assert.True(t, ok, "nothing to catch up")
+
+	for i, blocks := range []struct{ head, processed uint64 }{{1000, 0}, {1010, 50}, {1020, 100}} {
+		catchUp.SetReferenceHead(blocks.head)
+		catchUp.SetProcessedBlock(blocks.processed)
+		clock.Advance(time.Second)
+		waitSamples(t, catchUp.processedRate, uint64(i+1))
+		waitSamples(t, catchUp.headRate, uint64(i+1))
+	}
+
+	assert.Equal(t, uint64(920), catchUp.BlocksBehind())
+	assert.Equal(t, 50.0, catchUp.Rate())
+
+	eta, ok := catchUp.ETA()
+	require.True(t, ok)
+	assert.Equal(t, 23*time.Second, eta)
+	assert.Equal(t, "920 blocks behind, processing 50.000 blocks/s, caught up in 23s", catchUp.String())
+
+	expected := `
+		# HELP blocks_behind Number of blocks the processed block is behind the reference head
+		# TYPE blocks_behind gauge
+		blocks_behind 920
+		# HELP catch_up_blocks_per_second Average number of blocks processed per second
+		# TYPE catch_up_blocks_per_second gauge
+		catch_up_blocks_per_second 50
+		# HELP catch_up_eta_seconds Estimated number of seconds before the processed block catches up with the reference head, +Inf if not catching up
+		# TYPE catch_up_eta_seconds gauge
+		catch_up_eta_seconds 23
+	`
+	assert.NoError(t, testutil.GatherAndCompare(MustNewRegistry(set), strings.NewReader(expected)))
+
+	// Reference head moving faster than the processing, never catching up
+	catchUp.SetReferenceHead(1200)
+	catchUp.SetProcessedBlock(110)
+	clock.Advance(time.Second)
+	waitSamples(t, catchUp.processedRate, 4)
+	waitSamples(t, catchUp.headRate, 4)
+
+	_, ok = catchUp.ETA()
+	assert.False(t, ok)
+	assert.Equal(t, "1090 blocks behind, processing 30.000 blocks/s, not catching up", catchUp.String())
+
+	expected = `
+		# HELP catch_up_eta_seconds Estimated number of seconds before the processed block catches up with the reference head, +Inf if not catching up
+		# TYPE catch_up_eta_seconds gauge
+		catch_up_eta_seconds +Inf
+	`
+	assert.NoError(t, testutil.GatherAndCompare(MustNewRegistry(set), strings.NewReader(expected), "catch_up_eta_seconds"))
+
+	catchUp.SetProcessedBlock(1300)
+	assert.Equal(t, uint64(0), catchUp.BlocksBehind())
+}
+
+func TestCatchUpTracker_StartsAtNonZeroHeight(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	catchUp := NewSet().MustNewCatchUpTracker(time.Second, 2*time.Second, CounterClock(clock))
+	defer catchUp.Stop()
+
+	// Heights already reached on start are not counted as progress
+	catchUp.SetReferenceHead(15_000_000)
+	catchUp.SetProcessedBlock(14_000_000)
+	clock.Advance(time.Second)
+	waitSamples(t, catchUp.processedRate, 1)
+	waitSamples(t, catchUp.headRate, 1)
+
+	assert.Equal(t, 0.0, catchUp.Rate())
+	assert.Equal(t, 0.0, perSecond(catchUp.headRate))
+
+	catchUp.SetReferenceHead(15_000_010)
+	catchUp.SetProcessedBlock(14_000_100)
+	clock.Advance(time.Second)
+	waitSamples(t, catchUp.processedRate, 2)
+	waitSamples(t, catchUp.headRate, 2)
+
+	assert.Equal(t, 50.0, catchUp.Rate())
+	assert.Equal(t, 5.0, perSecond(catchUp.headRate))
+
+	eta, ok := catchUp.ETA()
+	require.True(t, ok)
+	assert.InDelta(t, 999_910/45.0, eta.Seconds(), 0.001)
+}
+
+func TestCatchUpTracker_Reorg(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	catchUp := NewSet().MustNewCatchUpTracker(time.Second, 2*time.Second, CounterClock(clock))
+	defer catchUp.Stop()
+
+	catchUp.SetReferenceHead(15_000_000)
+	for i, processed := range []uint64{14_000_000, 14_000_100, 14_000_099} {
+		catchUp.SetProcessedBlock(processed)
+		clock.Advance(time.Second)
+		waitSamples(t, catchUp.processedRate, uint64(i+1))
+	}
+
+	// The block going backwards is no progress, not a reset counting from zero
+	assert.Equal(t, 50.0, catchUp.Rate())
+}
+
+func TestCatchUpTracker_ReorgKeepsEstimate(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	catchUp := NewSet().MustNewCatchUpTracker(time.Second, 10*time.Second, CounterClock(clock))
+	defer catchUp.Stop()
+
+	sample := func(i int, head, processed uint64) {
+		catchUp.SetReferenceHead(head)
+		catchUp.SetProcessedBlock(processed)
+		clock.Advance(time.Second)
+		waitSamples(t, catchUp.processedRate, uint64(i+1))
+		waitSamples(t, catchUp.headRate, uint64(i+1))
+	}
+
+	for i := 0; i <= 10; i++ {
+		sample(i, 15_000_000+uint64(i)*10, 14_000_000+uint64(i)*50)
+	}
+
+	rate := catchUp.Rate()
+	eta, ok := catchUp.ETA()
+	require.True(t, ok)
+	assert.Equal(t, 50.0, rate)
+
+	// One block reorg of the processed block
+	sample(11, 15_000_110, 14_000_499)
+
+	reorgRate := catchUp.Rate()
+	reorgETA, ok := catchUp.ETA()
+	require.True(t, ok, "still catching up")
+	assert.False(t, math.IsInf(reorgRate, 0) || math.IsNaN(reorgRate))
+	assert.InEpsilon(t, rate, reorgRate, 0.15)
+	assert.InEpsilon(t, eta.Seconds(), reorgETA.Seconds(), 0.2)
+	assert.Equal(t, "999611 blocks behind, processing 45.000 blocks/s, caught up in 7h56m0s", catchUp.String())
+}
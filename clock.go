@@ -0,0 +1,122 @@
+package dmetrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts the time source of the time-based metrics, so a [FakeClock] can be
+// injected in tests (see [UseClock] and [CounterClock]) to compute rates and drifts
+// exactly instead of relying on sleeps.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the subset of `time.Ticker` used by the metrics, abstracted so it can
+// be driven by a [FakeClock].
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the [Clock] backed by the `time` package, used by default.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                  { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// FakeClock is a [Clock] whose time only moves when [FakeClock.Advance] is called,
+// firing the tickers whose deadline is reached. Like real tickers, a tick is dropped
+// when the previous one was not consumed yet.
+//
+// ```
+// clock := dmetrics.NewFakeClock(time.Unix(0, 0))
+// counter := dmetrics.MustNewAvgRateCounter(time.Second, 10*time.Second, "blocks", dmetrics.CounterClock(clock))
+// clock.Advance(time.Second)
+// ```
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ticker := &fakeTicker{clock: c, period: d, next: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, ticker)
+
+	return ticker
+}
+
+// Advance moves the time forward by the given duration, firing the tickers whose
+// deadline is reached along the way.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, ticker := range c.tickers {
+		for !ticker.next.After(c.now) {
+			select {
+			case ticker.c <- ticker.next:
+			default:
+			}
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	period time.Duration
+	next   time.Time
+	c      chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
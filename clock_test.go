@@ -0,0 +1,109 @@
+package dmetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(100, 0))
+	assert.Equal(t, time.Unix(100, 0), clock.Now())
+
+	ticker := clock.NewTicker(time.Second)
+	clock.Advance(500 * time.Millisecond)
+	assert.Len(t, ticker.C(), 0)
+	assert.Equal(t, 500*time.Millisecond, clock.Since(time.Unix(100, 0)))
+
+	clock.Advance(500 * time.Millisecond)
+	require.Len(t, ticker.C(), 1)
+	assert.Equal(t, time.Unix(101, 0), <-ticker.C())
+
+	// Ticks not consumed are dropped
+	clock.Advance(3 * time.Second)
+	require.Len(t, ticker.C(), 1)
+	assert.Equal(t, time.Unix(102, 0), <-ticker.C())
+
+	ticker.Stop()
+	clock.Advance(time.Second)
+	assert.Len(t, ticker.C(), 0)
+}
+
+func TestHeadTimeDrift_FakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+
+	drift := NewSet(UseClock(clock)).NewHeadTimeDrift("head_drift_fake_clock", DriftRefreshInterval(time.Second))
+	defer drift.Stop()
+
+	drift.SetBlockTime(time.Unix(990, 0))
+	assert.Equal(t, 10*time.Second, drift.Drift())
+
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, 15*time.Second, drift.Drift())
+}
+
+func TestHistogram_ObserveSinceFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	histogram := NewSet(UseClock(clock)).NewHistogram("observe_since_fake_clock")
+
+	start := clock.Now()
+	clock.Advance(1500 * time.Millisecond)
+	histogram.ObserveSince(start)
+
+	metric := &dto.Metric{}
+	require.NoError(t, histogram.Native().(prometheus.Metric).Write(metric))
+	assert.Equal(t, 1.5, metric.Histogram.GetSampleSum())
+}
+
+func TestAvgDurationCounter_AddElapsedTimeFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	counter := NewAvgDurationCounter(time.Minute, time.Second, "per block", CounterClock(clock))
+
+	start := clock.Now()
+	clock.Advance(2 * time.Second)
+	counter.AddElapsedTime(start)
+
+	assert.Equal(t, 2*time.Second, counter.Total())
+}
+
+func TestAvgDurationCounter_WindowFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	counter := NewAvgDurationCounter(time.Second, time.Second, "per block", CounterClock(clock))
+
+	counter.AddDuration(2 * time.Second)
+	counter.AddDuration(4 * time.Second)
+	assert.Equal(t, 3*time.Second, counter.Average())
+
+	clock.Advance(500 * time.Millisecond)
+	counter.AddDuration(6 * time.Second)
+	assert.Equal(t, 4*time.Second, counter.Average())
+
+	// The first two durations fall out of the window
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, 6*time.Second, counter.Average())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, time.Duration(0), counter.Average())
+	assert.Equal(t, 12*time.Second, counter.Total())
+}
+
+func TestClock_ZeroValueFallsBackToRealClock(t *testing.T) {
+	set := &Set{}
+	assert.NotPanics(t, func() {
+		set.NewHistogram("observe_since_zero_value_set").ObserveSince(time.Now())
+		set.NewHistogramVec("observe_since_zero_value_set_vec", []string{"kind"}).ObserveSince(time.Now(), "a")
+		set.NewHeadTimeDrift("head_drift_zero_value_set").Stop()
+
+		tracker := NewSet(UseClock(nil)).NewHeadTracker()
+		tracker.SetBlock(1, "a", time.Now())
+		tracker.Drift()
+	})
+
+	counter := NewAvgDurationCounter(time.Second, time.Second, "per block", CounterClock(nil))
+	assert.NotPanics(t, func() { counter.AddElapsedTime(time.Now().Add(-time.Second)) })
+	assert.Equal(t, 1, int(counter.Total().Round(time.Second)/time.Second))
+}
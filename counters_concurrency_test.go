@@ -0,0 +1,75 @@
+package dmetrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests are mostly useful with `go test -race`, they hammer the counters from
+// many goroutines and check that no increment is lost.
+
+const (
+	hammerGoroutines = 32
+	hammerIterations = 1000
+)
+
+func hammer(f func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < hammerGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < hammerIterations; j++ {
+				f()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRateCounter_Concurrent(t *testing.T) {
+	r := NewRateCounter(time.Minute, "events")
+	hammer(func() {
+		r.Inc()
+		r.IncBy(2)
+		_ = r.String()
+	})
+
+	assert.Equal(t, uint64(3*hammerGoroutines*hammerIterations), r.Total())
+}
+
+func TestAvgCounter_Concurrent(t *testing.T) {
+	c := NewAvgCounter(time.Minute, "cache hits")
+	hammer(func() {
+		c.IncBy(3)
+		_ = c.String()
+	})
+
+	assert.Equal(t, uint64(3*hammerGoroutines*hammerIterations), c.Total())
+}
+
+func TestAvgDurationCounter_Concurrent(t *testing.T) {
+	c := NewAvgDurationCounter(time.Minute, time.Millisecond, "per block")
+	hammer(func() {
+		c.AddDuration(time.Millisecond)
+		_ = c.String()
+	})
+
+	assert.Equal(t, time.Duration(hammerGoroutines*hammerIterations)*time.Millisecond, c.Total())
+}
+
+func TestAvgRateCounter_Concurrent(t *testing.T) {
+	c := MustNewAvgRateCounter(time.Millisecond, 10*time.Millisecond, "blocks")
+	defer c.Stop()
+
+	hammer(func() {
+		c.Add(1)
+		_ = c.String()
+	})
+
+	c.SyncNow()
+	assert.Equal(t, uint64(hammerGoroutines*hammerIterations), c.Total())
+}
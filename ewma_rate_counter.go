@@ -0,0 +1,180 @@
+package dmetrics
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
+)
+
+// EWMARateCounter tracks the rate of events as an exponentially weighted moving
+// average, like the Unix load averages. Compared to [AvgRateCounter], old samples
+// fade out progressively instead of falling out of the window all at once, so the
+// rate does not jump when a burst gets older than the period.
+type EWMARateCounter struct {
+	*ewmaRate
+}
+
+// ewmaRate is referenced by the janitor goroutine, the finalizer set on the
+// [EWMARateCounter] wrapping it stops the janitor once the counter is garbage collected.
+type ewmaRate struct {
+	c *atomic.Uint64
+
+	samplingWindow time.Duration
+	decay          time.Duration
+	unit           string
+	alpha          float64
+	janitor        *janitor
+
+	lock      sync.Mutex
+	lastTotal uint64
+	rate      float64
+	sampled   bool
+}
+
+// MustNewEWMARateCounter acts like [NewEWMARateCounter] but panics if an error occurs.
+func MustNewEWMARateCounter(samplingWindow time.Duration, decay time.Duration, unit string, options ...CounterOption) *EWMARateCounter {
+	c, err := NewEWMARateCounter(samplingWindow, decay, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewEWMARateCounter tracks the rate of events per <samplingWindow>. The count of
+// events is sampled at every <samplingWindow> and folded into the average, the
+// weight of a sample decaying exponentially with the <decay> time constant. Use a
+// <decay> of 1, 5 or 15 minutes for load average style rates.
+//
+// ```
+// counter := MustNewEWMARateCounter(5*time.Second, time.Minute, "blocks")
+// counter.Add(1)
+//
+// counter.String() == 12.345 blocks/5s (ewma over 1m0s, 2883 total)
+// ```
+func NewEWMARateCounter(samplingWindow time.Duration, decay time.Duration, unit string, options ...CounterOption) (*EWMARateCounter, error) {
+	if samplingWindow <= 0 {
+		return nil, fmt.Errorf("sampling window must be greater then 0")
+	}
+
+	if decay < samplingWindow {
+		return nil, fmt.Errorf("decay (%s) must be greater or equal to sampling window (%s) but it's not", decay, samplingWindow)
+	}
+
+	r := &ewmaRate{
+		c:              atomic.NewUint64(0),
+		samplingWindow: samplingWindow,
+		decay:          decay,
+		unit:           unit,
+		alpha:          1 - math.Exp(-samplingWindow.Seconds()/decay.Seconds()),
+	}
+
+	r.janitor = newJanitor(samplingWindow, newCounterOptions(options).clock, r.syncNow)
+
+	c := &EWMARateCounter{r}
+	runtime.SetFinalizer(c, (*EWMARateCounter).Stop)
+
+	return c, nil
+}
+
+// Add tracks a number of events, to be used to compute the rate
+func (c *ewmaRate) Add(v uint64) {
+	c.c.Add(v)
+}
+
+func (c *ewmaRate) Total() uint64 {
+	return c.c.Load()
+}
+
+// Rate returns the average number of events per sampling window, 0 until the first
+// sample is taken.
+func (c *ewmaRate) Rate() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.rate
+}
+
+func (c *ewmaRate) RateString() string {
+	return strconv.FormatFloat(c.Rate(), 'f', 3, 64)
+}
+
+func (c *ewmaRate) String() string {
+	return fmt.Sprintf("%s %s/%s (ewma over %s, %d total)", c.RateString(), c.unit, timeUnitToString(c.samplingWindow), c.decay, c.Total())
+}
+
+// SyncNow forces a sample to be taken right away, blocking until it is.
+func (c *ewmaRate) SyncNow() {
+	c.janitor.forceSync()
+}
+
+// Stop stops the background sampling, the rate is frozen afterward.
+func (c *ewmaRate) Stop() {
+	c.janitor.shutdown()
+}
+
+func (c *ewmaRate) syncNow() {
+	total := c.c.Load()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instant := float64(total - c.lastTotal)
+	c.lastTotal = total
+
+	if !c.sampled {
+		// Seeded with the first sample, otherwise the rate would slowly ramp up from 0
+		c.rate = instant
+		c.sampled = true
+		return
+	}
+
+	c.rate += c.alpha * (instant - c.rate)
+}
+
+// MarshalLogObject logs the `rate`, `total`, `unit`, `window_seconds` and
+// `decay_seconds` fields.
+func (c *ewmaRate) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddFloat64("rate", c.Rate())
+	enc.AddUint64("total", c.Total())
+	enc.AddString("unit", c.unit)
+	enc.AddFloat64("window_seconds", c.samplingWindow.Seconds())
+	enc.AddFloat64("decay_seconds", c.decay.Seconds())
+	return nil
+}
+
+func (c *ewmaRate) MarshalJSON() ([]byte, error) {
+	return marshalObjectJSON(c)
+}
+
+// NewEWMARateCounter creates an [EWMARateCounter] whose rate is also exposed as a
+// gauge of the set, see [NewEWMARateCounter] for the meaning of the parameters.
+func (s *Set) NewEWMARateCounter(name string, samplingWindow time.Duration, decay time.Duration, unit string, options ...CounterOption) (*EWMARateCounter, error) {
+	c, err := NewEWMARateCounter(samplingWindow, decay, unit, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	name = s.computeMetricName(name)
+	help := fmt.Sprintf("Exponentially weighted moving average over %s of the number of %s per %s", decay, unit, samplingWindow)
+	// Captures the wrapper and not the embedded rate (like the `c.Rate` method value
+	// would), so the finalizer never stops the janitor while the Set exports the gauge
+	s.add(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 { return c.Rate() }))
+
+	return c, nil
+}
+
+// MustNewEWMARateCounter acts like [Set.NewEWMARateCounter] but panics if an error occurs.
+func (s *Set) MustNewEWMARateCounter(name string, samplingWindow time.Duration, decay time.Duration, unit string, options ...CounterOption) *EWMARateCounter {
+	c, err := s.NewEWMARateCounter(name, samplingWindow, decay, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,67 @@
+package dmetrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEWMARateCounter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	c := MustNewEWMARateCounter(time.Second, 2*time.Second, "blocks", CounterClock(clock))
+	defer c.Stop()
+
+	assert.Equal(t, 0.0, c.Rate())
+
+	c.Add(10)
+	clock.Advance(time.Second)
+	waitEWMASample(t, c, 10)
+	assert.Equal(t, "10.000 blocks/s (ewma over 2s, 10 total)", c.String())
+
+	// No event, the rate decays towards 0 without dropping to it
+	alpha := 1 - math.Exp(-0.5)
+	clock.Advance(time.Second)
+	waitEWMASample(t, c, 10-alpha*10)
+	assert.InDelta(t, 6.065, c.Rate(), 0.001)
+
+	c.Add(20)
+	c.SyncNow()
+	assert.InDelta(t, 6.065+alpha*(20-6.065), c.Rate(), 0.001)
+}
+
+func TestEWMARateCounter_Invalid(t *testing.T) {
+	_, err := NewEWMARateCounter(0, time.Minute, "blocks")
+	assert.Error(t, err)
+
+	_, err = NewEWMARateCounter(time.Minute, time.Second, "blocks")
+	assert.Error(t, err)
+}
+
+func TestSet_NewEWMARateCounter(t *testing.T) {
+	set := NewSet(PrefixNameWith("indexer"))
+	c := set.MustNewEWMARateCounter("block_rate", time.Second, time.Minute, "blocks")
+	defer c.Stop()
+
+	c.Add(5)
+	c.SyncNow()
+
+	expected := `
+		# HELP indexer_block_rate Exponentially weighted moving average over 1m0s of the number of blocks per 1s
+		# TYPE indexer_block_rate gauge
+		indexer_block_rate 5
+	`
+	assert.NoError(t, testutil.GatherAndCompare(MustNewRegistry(set), strings.NewReader(expected)))
+}
+
+// waitEWMASample waits until the janitor of the counter took the sample leading to
+// the expected rate
+func waitEWMASample(t *testing.T, c *EWMARateCounter, rate float64) {
+	t.Helper()
+
+	require.Eventually(t, func() bool { return math.Abs(c.Rate()-rate) < 1e-9 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,127 @@
+package dmetrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ExemplarTraceIDLabel is the exemplar label name used to attach a trace ID to an
+// observation, it follows the OpenMetrics convention so that Grafana and friends
+// can link the sample to the actual trace.
+const ExemplarTraceIDLabel = "trace_id"
+
+// TraceIDExtractor extracts the trace ID, if any, out of a `context.Context`. It must
+// return an empty string when there is no trace ID attached to the context.
+type TraceIDExtractor func(ctx context.Context) string
+
+var traceIDExtractorLock sync.RWMutex
+var traceIDExtractor TraceIDExtractor = func(ctx context.Context) string { return "" }
+
+// SetTraceIDExtractor configures the extractor used by [TraceIDFromContext] and
+// [ExemplarFromContext]. This library does not depend on any tracing library, so it's
+// up to the caller to plug the extraction logic, usually at `init` time, for example
+// with OpenTelemetry:
+//
+//	dmetrics.SetTraceIDExtractor(func(ctx context.Context) string {
+//		spanContext := trace.SpanContextFromContext(ctx)
+//		if !spanContext.IsSampled() {
+//			return ""
+//		}
+//
+//		return spanContext.TraceID().String()
+//	})
+func SetTraceIDExtractor(extractor TraceIDExtractor) {
+	if extractor == nil {
+		extractor = func(ctx context.Context) string { return "" }
+	}
+
+	traceIDExtractorLock.Lock()
+	defer traceIDExtractorLock.Unlock()
+
+	traceIDExtractor = extractor
+}
+
+// TraceIDFromContext returns the trace ID found in the context using the extractor
+// configured through [SetTraceIDExtractor], an empty string if there is none.
+func TraceIDFromContext(ctx context.Context) string {
+	traceIDExtractorLock.RLock()
+	extractor := traceIDExtractor
+	traceIDExtractorLock.RUnlock()
+
+	return extractor(ctx)
+}
+
+// ExemplarFromContext returns the exemplar labels holding the trace ID found in the
+// context, or `nil` if there is none. A `nil` exemplar is accepted by all `...WithExemplar`
+// methods in which case the value is recorded without an exemplar.
+func ExemplarFromContext(ctx context.Context) prometheus.Labels {
+	return traceIDExemplar(TraceIDFromContext(ctx))
+}
+
+func traceIDExemplar(traceID string) prometheus.Labels {
+	if traceID == "" {
+		return nil
+	}
+
+	return prometheus.Labels{ExemplarTraceIDLabel: traceID}
+}
+
+// AddWithExemplar adds the value to the counter and attaches the exemplar to it, a `nil`
+// exemplar records the value without touching the current exemplar.
+func (c *Counter) AddWithExemplar(value float64, exemplar prometheus.Labels) {
+	addWithExemplar(c.p, value, exemplar)
+}
+
+// IncWithExemplar is like [Counter.AddWithExemplar] with a value of 1.
+func (c *Counter) IncWithExemplar(exemplar prometheus.Labels) {
+	addWithExemplar(c.p, 1, exemplar)
+}
+
+func (c *CounterVec) AddWithExemplar(value float64, exemplar prometheus.Labels, labels ...string) {
+	addWithExemplar(c.p.WithLabelValues(labels...), value, exemplar)
+}
+
+func (c *CounterVec) IncWithExemplar(exemplar prometheus.Labels, labels ...string) {
+	addWithExemplar(c.p.WithLabelValues(labels...), 1, exemplar)
+}
+
+// ObserveWithExemplar records the value and attaches the exemplar to the bucket it
+// falls in, a `nil` exemplar records the value without touching the current exemplar.
+func (h *Histogram) ObserveWithExemplar(value float64, exemplar prometheus.Labels) {
+	observeWithExemplar(h.p, value, exemplar)
+}
+
+// ObserveDurationWithExemplar records the duration in seconds and attaches the trace ID
+// to it as an exemplar, an empty trace ID records the duration without an exemplar.
+func (h *Histogram) ObserveDurationWithExemplar(value time.Duration, traceID string) {
+	observeWithExemplar(h.p, value.Seconds(), traceIDExemplar(traceID))
+}
+
+func (h *HistogramVec) ObserveWithExemplar(value float64, exemplar prometheus.Labels, labels ...string) {
+	observeWithExemplar(h.p.WithLabelValues(labels...), value, exemplar)
+}
+
+func (h *HistogramVec) ObserveDurationWithExemplar(value time.Duration, traceID string, labels ...string) {
+	observeWithExemplar(h.p.WithLabelValues(labels...), value.Seconds(), traceIDExemplar(traceID))
+}
+
+func addWithExemplar(counter prometheus.Counter, value float64, exemplar prometheus.Labels) {
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		adder.AddWithExemplar(value, exemplar)
+		return
+	}
+
+	counter.Add(value)
+}
+
+func observeWithExemplar(observer prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		exemplarObserver.ObserveWithExemplar(value, exemplar)
+		return
+	}
+
+	observer.Observe(value)
+}
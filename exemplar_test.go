@@ -0,0 +1,122 @@
+package dmetrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type traceIDKey struct{}
+
+func TestCounter_AddWithExemplar(t *testing.T) {
+	set := NewSet()
+	counter := set.NewCounter("exemplar_counter")
+
+	counter.AddWithExemplar(2, prometheus.Labels{"trace_id": "abc"})
+	counter.AddWithExemplar(3, nil)
+
+	model := writeMetric(t, counter.Native())
+	assert.Equal(t, 5.0, model.Counter.GetValue())
+	require.NotNil(t, model.Counter.Exemplar)
+	assert.Equal(t, 2.0, model.Counter.Exemplar.GetValue())
+	assert.Equal(t, map[string]string{"trace_id": "abc"}, labelPairsToMap(model.Counter.Exemplar.Label))
+}
+
+func TestCounterVec_AddWithExemplar(t *testing.T) {
+	set := NewSet()
+	counter := set.NewCounterVec("exemplar_counter_vec", []string{"source"})
+
+	counter.AddWithExemplar(4, prometheus.Labels{"trace_id": "abc"}, "a")
+
+	model := writeMetric(t, counter.Native().WithLabelValues("a"))
+	assert.Equal(t, 4.0, model.Counter.GetValue())
+	require.NotNil(t, model.Counter.Exemplar)
+	assert.Equal(t, map[string]string{"trace_id": "abc"}, labelPairsToMap(model.Counter.Exemplar.Label))
+}
+
+func TestHistogram_ObserveDurationWithExemplar(t *testing.T) {
+	set := NewSet()
+	histogram := set.NewHistogram("exemplar_histogram")
+
+	histogram.ObserveDurationWithExemplar(20*time.Millisecond, "abc")
+	histogram.ObserveDurationWithExemplar(3*time.Second, "")
+
+	model := writeMetric(t, histogram.Native())
+	assert.EqualValues(t, 2, model.Histogram.GetSampleCount())
+
+	var exemplars []*dto.Exemplar
+	for _, bucket := range model.Histogram.Bucket {
+		if bucket.Exemplar != nil {
+			exemplars = append(exemplars, bucket.Exemplar)
+		}
+	}
+
+	require.Len(t, exemplars, 1)
+	assert.Equal(t, 0.02, exemplars[0].GetValue())
+	assert.Equal(t, map[string]string{"trace_id": "abc"}, labelPairsToMap(exemplars[0].Label))
+}
+
+func TestExemplarFromContext(t *testing.T) {
+	defer SetTraceIDExtractor(nil)
+
+	assert.Nil(t, ExemplarFromContext(context.Background()))
+
+	SetTraceIDExtractor(func(ctx context.Context) string {
+		traceID, _ := ctx.Value(traceIDKey{}).(string)
+		return traceID
+	})
+
+	assert.Nil(t, ExemplarFromContext(context.Background()))
+	assert.Equal(t, prometheus.Labels{"trace_id": "abc"}, ExemplarFromContext(context.WithValue(context.Background(), traceIDKey{}, "abc")))
+}
+
+func TestHandler_OpenMetrics(t *testing.T) {
+	counter := NewSet().NewCounter("exemplar_open_metrics")
+	require.NoError(t, prometheus.DefaultRegisterer.Register(counter))
+	defer prometheus.DefaultRegisterer.Unregister(counter)
+
+	counter.AddWithExemplar(1, prometheus.Labels{"trace_id": "abc"})
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	request.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, response.Header.Get("Content-Type"), "application/openmetrics-text")
+	assert.Contains(t, string(body), `exemplar_open_metrics 1.0 # {trace_id="abc"} 1.0`)
+}
+
+func writeMetric(t *testing.T, metric prometheus.Metric) *dto.Metric {
+	t.Helper()
+
+	model := new(dto.Metric)
+	require.NoError(t, metric.Write(model))
+
+	return model
+}
+
+func labelPairsToMap(pairs []*dto.LabelPair) map[string]string {
+	out := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		out[pair.GetName()] = pair.GetValue()
+	}
+
+	return out
+}
@@ -1,9 +1,12 @@
 package dmetrics
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
+
+	"go.uber.org/zap/zapcore"
 )
 
 var InferUnit = time.Duration(0)
@@ -67,3 +70,25 @@ func inferUnit(d time.Duration) time.Duration {
 
 	return time.Minute
 }
+
+var _ zapcore.ObjectMarshaler = (*RateCounter)(nil)
+var _ zapcore.ObjectMarshaler = (*AvgCounter)(nil)
+var _ zapcore.ObjectMarshaler = (*AvgDurationCounter)(nil)
+var _ zapcore.ObjectMarshaler = (*AvgRateCounter)(nil)
+var _ zapcore.ObjectMarshaler = (*AvgRatePromCounter)(nil)
+var _ json.Marshaler = (*RateCounter)(nil)
+var _ json.Marshaler = (*AvgCounter)(nil)
+var _ json.Marshaler = (*AvgDurationCounter)(nil)
+var _ json.Marshaler = (*AvgRateCounter)(nil)
+var _ json.Marshaler = (*AvgRatePromCounter)(nil)
+
+// marshalObjectJSON marshals to JSON the fields logged by the marshaler, so the
+// counters have the same fields whether they are logged or marshaled.
+func marshalObjectJSON(marshaler zapcore.ObjectMarshaler) ([]byte, error) {
+	encoder := zapcore.NewMapObjectEncoder()
+	if err := marshaler.MarshalLogObject(encoder); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(encoder.Fields)
+}
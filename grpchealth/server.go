@@ -0,0 +1,169 @@
+// Package grpchealth implements the gRPC health checking protocol (`grpc.health.v1.Health`)
+// on top of the readiness tracked by `dmetrics.AppReadiness`, making it usable by
+// Kubernetes gRPC probes.
+package grpchealth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dmetrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the `grpc.health.v1.Health` service. The status of a service is
+// `SERVING` when the `dmetrics.AppReadiness` backing it is ready, `NOT_SERVING`
+// otherwise. A service is backed by the app explicitly attached to it through
+// [Service], or else by the app of the same name created through
+// `dmetrics.Set.NewAppReadiness`. The empty service name, used by probes to check
+// the server as a whole, is `SERVING` when all the apps of the process are ready.
+//
+// ```
+// server := grpc.NewServer()
+// grpchealth.NewServer(grpchealth.Service("sf.firehose.v2.Stream", readiness)).Register(server)
+// ```
+type Server struct {
+	healthpb.UnimplementedHealthServer
+
+	pollInterval time.Duration
+
+	lock     sync.RWMutex
+	services map[string]*dmetrics.AppReadiness
+}
+
+type Option func(s *Server)
+
+const defaultPollInterval = time.Second
+
+// Service attaches the readiness of the app to the given gRPC service name.
+func Service(name string, app *dmetrics.AppReadiness) Option {
+	return func(s *Server) {
+		s.services[name] = app
+	}
+}
+
+// PollInterval configures at which interval `Watch` re-evaluates the statuses that
+// cannot be followed through `dmetrics.AppReadiness.Watch`, that is the overall
+// status and the status of services unknown when the watch started, defaults to 1s.
+// A zero or negative interval keeps the default.
+func PollInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.pollInterval = interval
+	}
+}
+
+func NewServer(options ...Option) *Server {
+	s := &Server{
+		pollInterval: defaultPollInterval,
+		services:     map[string]*dmetrics.AppReadiness{},
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	if s.pollInterval <= 0 {
+		s.pollInterval = defaultPollInterval
+	}
+
+	return s
+}
+
+// SetService attaches the readiness of the app to the given gRPC service name,
+// replacing any app previously attached to it.
+func (s *Server) SetService(name string, app *dmetrics.AppReadiness) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.services[name] = app
+}
+
+// Register registers the health service on the gRPC server.
+func (s *Server) Register(server *grpc.Server) {
+	healthpb.RegisterHealthServer(server, s)
+}
+
+func (s *Server) Check(ctx context.Context, request *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	servingStatus := s.status(request.Service)
+	if servingStatus == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", request.Service)
+	}
+
+	return &healthpb.HealthCheckResponse{Status: servingStatus}, nil
+}
+
+// Watch streams the status of the service, sending it right away and then each time
+// it changes. As mandated by the protocol, an unknown service is reported as
+// `SERVICE_UNKNOWN` and the stream stays open in case the service appears later.
+func (s *Server) Watch(request *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	var changes <-chan dmetrics.State
+	lastStatus := healthpb.HealthCheckResponse_ServingStatus(-1)
+	for {
+		if changes == nil && request.Service != "" {
+			if app := s.lookup(request.Service); app != nil {
+				changes = app.Watch(ctx)
+			}
+		}
+
+		servingStatus := s.status(request.Service)
+		if servingStatus != lastStatus {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus}); err != nil {
+				return status.Error(codes.Canceled, "stream has ended")
+			}
+			lastStatus = servingStatus
+		}
+
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return status.Error(codes.Canceled, "stream has ended")
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		}
+	}
+}
+
+func (s *Server) status(service string) healthpb.HealthCheckResponse_ServingStatus {
+	if service == "" {
+		return servingStatus(dmetrics.IsReady())
+	}
+
+	app := s.lookup(service)
+	if app == nil {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+
+	return servingStatus(app.IsReady())
+}
+
+func (s *Server) lookup(service string) *dmetrics.AppReadiness {
+	s.lock.RLock()
+	app, found := s.services[service]
+	s.lock.RUnlock()
+
+	if found {
+		return app
+	}
+
+	app, _ = dmetrics.LookupAppReadiness(service)
+	return app
+}
+
+func servingStatus(ready bool) healthpb.HealthCheckResponse_ServingStatus {
+	if ready {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
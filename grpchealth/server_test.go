@@ -0,0 +1,120 @@
+package grpchealth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, server *Server) healthpb.HealthClient {
+	listener := bufconn.Listen(1024 * 1024)
+
+	grpcServer := grpc.NewServer()
+	server.Register(grpcServer)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestServer_Check(t *testing.T) {
+	firehose := dmetrics.NewSet().NewAppReadiness("grpchealth_check_firehose")
+	relayer := dmetrics.NewSet().NewAppReadiness("grpchealth_check_relayer")
+	firehose.SetNotReady("starting")
+	relayer.SetNotReady("starting")
+
+	client := newTestClient(t, NewServer(Service("sf.firehose.v2.Stream", firehose)))
+	ctx := context.Background()
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		response, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return response.Status
+	}
+
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check("sf.firehose.v2.Stream"))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+
+	firehose.SetReady()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check("sf.firehose.v2.Stream"))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check("grpchealth_check_relayer"), "apps are found by name")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+
+	relayer.SetReady()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check("grpchealth_check_relayer"))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_Watch(t *testing.T) {
+	app := dmetrics.NewSet().NewAppReadiness("grpchealth_watch")
+	app.SetNotReady("starting")
+
+	// Apps are process wide, leave it ready to not affect the overall status checked by other tests
+	t.Cleanup(app.SetReady)
+
+	server := NewServer(PollInterval(10 * time.Millisecond))
+	client := newTestClient(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "sf.substreams.v1.Stream"})
+	require.NoError(t, err)
+
+	recv := func() healthpb.HealthCheckResponse_ServingStatus {
+		response, err := stream.Recv()
+		require.NoError(t, err)
+		return response.Status
+	}
+
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVICE_UNKNOWN, recv())
+
+	// Service attached after the watch started is picked up on the next poll
+	server.SetService("sf.substreams.v1.Stream", app)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, recv())
+
+	app.SetReady()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, recv())
+
+	app.SetNotReady("shutting down")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, recv())
+}
+
+func TestServer_InvalidPollInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		server := NewServer(PollInterval(interval))
+		assert.Equal(t, defaultPollInterval, server.pollInterval)
+
+		client := newTestClient(t, server)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+		require.NoError(t, err)
+
+		response, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVICE_UNKNOWN, response.Status)
+		cancel()
+	}
+}
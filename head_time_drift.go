@@ -15,10 +15,14 @@
 package dmetrics
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/atomic"
+	"go.uber.org/zap"
 )
 
 var headTimeDriftGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -30,40 +34,282 @@ var headBlockNumber = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 	Name: "head_block_number",
 }, []string{"app"})
 
+var headStalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "head_stalls_total",
+	Help: "Number of times the head of an app stopped progressing for longer than the stall timeout",
+}, []string{"app"})
+
+var registerLegacyHeadMetricsOnce sync.Once
+
+// registerLegacyHeadMetrics registers the process wide head metrics on first use only,
+// so processes relying solely on [HeadTracker] are free to use the same metric names.
+func registerLegacyHeadMetrics() {
+	registerLegacyHeadMetricsOnce.Do(func() {
+		registerHeadMetrics(prometheus.DefaultRegisterer)
+	})
+}
+
+// registerHeadMetrics never panics as it runs on first use, a metric clashing with an
+// already registered one, like a [HeadTracker] metric, is logged and left unregistered.
+func registerHeadMetrics(registerer prometheus.Registerer) {
+	for _, collector := range []prometheus.Collector{headTimeDriftGauge, headBlockNumber, headStalls} {
+		if err := registerer.Register(collector); err != nil {
+			var alreadyRegistered prometheus.AlreadyRegisteredError
+			if errors.As(err, &alreadyRegistered) && alreadyRegistered.ExistingCollector == collector {
+				continue
+			}
+
+			zlog.Warn("unable to register head metric, it will not be exported", zap.Error(err))
+		}
+	}
+}
+
+// HeadTimeDrift tracks how far from real-time the head block of an app is, exposed
+// through the `head_block_time_drift` gauge. The gauge is refreshed at a regular
+// interval by a background goroutine so it keeps growing when no block is received.
+//
+// ```
+// drift := metricSet.NewHeadTimeDrift("relayer")
+// drift.Start(ctx)
+// defer drift.Stop()
+//
+// drift.SetBlockTime(block.Time())
+// ```
+//
+// It can also act as a watchdog detecting when the head stops progressing, see
+// [StallTimeout].
 type HeadTimeDrift struct {
-	headBlockTimeCh chan time.Time
 	service         string
-	started         *atomic.Bool
+	refreshInterval time.Duration
+	clock           Clock
+	lastBlockTime   *atomic.Int64
+
+	stallTimeout   time.Duration
+	stallReadiness *AppReadiness
+	stallComponent string
+	onStall        func(stalled bool)
+	lastProgress   *atomic.Int64
+
+	// component is the one flagged while stalled, created on the first stall, and
+	// owned when it was created by this drift. Only used by the background goroutine.
+	component     *ReadinessComponent
+	ownsComponent bool
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
 }
 
-func (s *Set) NewHeadTimeDrift(service string) *HeadTimeDrift {
-	headBlockTimeCh := make(chan time.Time)
+type HeadTimeDriftOption func(h *HeadTimeDrift)
+
+const defaultDriftRefreshInterval = 500 * time.Millisecond
 
+// DriftRefreshInterval configures at which interval the drift gauge is refreshed
+// while no new block time is received, defaults to 500ms. A zero or negative interval
+// keeps the default.
+func DriftRefreshInterval(interval time.Duration) HeadTimeDriftOption {
+	return func(h *HeadTimeDrift) {
+		h.refreshInterval = interval
+	}
+}
+
+// DriftClock configures the clock used to compute the drift, defaults to the clock
+// of the set (see [UseClock]).
+func DriftClock(clock Clock) HeadTimeDriftOption {
+	return func(h *HeadTimeDrift) {
+		h.clock = clock
+	}
+}
+
+// StallTimeout enables the stall detection, the head is considered stalled when no
+// block time was set for longer than the timeout. The head is checked at every
+// refresh interval (see [DriftRefreshInterval]), a stall increments the
+// `head_stalls_total` counter and the head recovers automatically as soon as a new
+// block time is set.
+func StallTimeout(timeout time.Duration) HeadTimeDriftOption {
+	return func(h *HeadTimeDrift) {
+		h.stallTimeout = timeout
+	}
+}
+
+// StallReadiness flags the <componentName> component of the app (see
+// [AppReadiness.Component]) not ready with reason "stalled" while the head is
+// stalled, see [StallTimeout]. An empty <componentName> defaults to
+// `head_stall:<service>`. Once the [HeadTimeDrift] is stopped, the head is no longer
+// watched, the component is removed if the drift created it and flagged ready
+// otherwise.
+func StallReadiness(app *AppReadiness, componentName string) HeadTimeDriftOption {
+	return func(h *HeadTimeDrift) {
+		h.stallReadiness = app
+		h.stallComponent = componentName
+	}
+}
+
+// OnStall registers a callback invoked with `true` when the head stalls and with
+// `false` when it recovers, see [StallTimeout]. The callback is invoked from the
+// background goroutine of the [HeadTimeDrift].
+func OnStall(callback func(stalled bool)) HeadTimeDriftOption {
+	return func(h *HeadTimeDrift) {
+		h.onStall = callback
+	}
+}
+
+func (s *Set) NewHeadTimeDrift(service string, options ...HeadTimeDriftOption) *HeadTimeDrift {
 	h := &HeadTimeDrift{
-		headBlockTimeCh: headBlockTimeCh,
 		service:         service,
-		started:         atomic.NewBool(false),
+		refreshInterval: defaultDriftRefreshInterval,
+		clock:           s.getClock(),
+		lastBlockTime:   atomic.NewInt64(0),
+		lastProgress:    atomic.NewInt64(0),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(h)
+	}
+
+	if h.refreshInterval <= 0 {
+		h.refreshInterval = defaultDriftRefreshInterval
+	}
+
+	if h.clock == nil {
+		h.clock = RealClock
+	}
+
+	if h.stallComponent == "" {
+		h.stallComponent = "head_stall:" + service
 	}
 
 	return h
 }
 
+// Start launches the background goroutine refreshing the drift gauge, it runs until
+// the context is canceled or [HeadTimeDrift.Stop] is called. Calling it more than
+// once has no effect. For backward compatibility, the first [HeadTimeDrift.SetBlockTime]
+// starts it with a background context if it was not started explicitly.
+func (h *HeadTimeDrift) Start(ctx context.Context) {
+	h.startOnce.Do(func() {
+		registerLegacyHeadMetrics()
+
+		// The stall timeout counts from the start until the first block is received
+		h.lastProgress.CAS(0, h.clock.Now().UnixNano())
+		go h.run(ctx, h.clock.NewTicker(h.refreshInterval))
+	})
+}
+
+// Stop stops the background goroutine and waits for it to terminate, the tracker
+// cannot be started again afterward.
+func (h *HeadTimeDrift) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+
+		// Ensures the goroutine is never started after a stop
+		h.startOnce.Do(func() { close(h.done) })
+		<-h.done
+	})
+}
+
+func (h *HeadTimeDrift) run(ctx context.Context, ticker Ticker) {
+	defer close(h.done)
+	defer ticker.Stop()
+	stalled := false
+	defer func() {
+		switch {
+		case h.component == nil:
+		case h.ownsComponent:
+			h.stallReadiness.removeComponent(h.component)
+		case stalled:
+			h.component.SetReady()
+		}
+	}()
+
+	for {
+		select {
+		case <-ticker.C():
+			h.refresh()
+			stalled = h.checkStall(stalled)
+		case <-ctx.Done():
+			return
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// SetBlockTime records the time of the current head block, it never blocks and only
+// the latest block time is kept.
 func (h *HeadTimeDrift) SetBlockTime(blockTime time.Time) {
-	if !h.started.Load() {
-		go func() {
-			headBlockTime := time.Time{}
-			for {
-				select {
-				case blockTime := <-h.headBlockTimeCh:
-					headBlockTime = blockTime
-				case <-time.After(500 * time.Millisecond):
-				}
-				headTimeDriftGauge.WithLabelValues(h.service).Set(time.Since(headBlockTime).Seconds())
+	h.Start(context.Background())
+
+	h.lastBlockTime.Store(blockTime.UnixNano())
+	h.lastProgress.Store(h.clock.Now().UnixNano())
+	h.refresh()
+}
+
+// checkStall detects stalls and recoveries, returning whether the head is now stalled
+func (h *HeadTimeDrift) checkStall(stalled bool) bool {
+	if h.stallTimeout <= 0 {
+		return false
+	}
+
+	nowStalled := h.clock.Since(time.Unix(0, h.lastProgress.Load())) > h.stallTimeout
+	if nowStalled == stalled {
+		return stalled
+	}
+
+	if nowStalled {
+		zlog.Warn("head stalled", zap.String("app", h.service), zap.Duration("stall_timeout", h.stallTimeout))
+		headStalls.WithLabelValues(h.service).Inc()
+		if h.stallReadiness != nil {
+			if h.component == nil {
+				h.component, h.ownsComponent = h.stallReadiness.component(h.stallComponent)
 			}
-		}()
-		h.started.Store(true)
+			h.component.SetNotReady("stalled")
+		}
+	} else {
+		zlog.Info("head recovered from stall", zap.String("app", h.service))
+		if h.component != nil {
+			h.component.SetReady()
+		}
+	}
+
+	if h.onStall != nil {
+		h.onStall(nowStalled)
+	}
+
+	return nowStalled
+}
+
+func (h *HeadTimeDrift) refresh() {
+	if h.lastBlockTime.Load() == 0 {
+		return
+	}
+
+	headTimeDriftGauge.WithLabelValues(h.service).Set(h.Drift().Seconds())
+}
+
+// LastBlockTime returns the last block time received, the zero time if none was
+// received yet.
+func (h *HeadTimeDrift) LastBlockTime() time.Time {
+	nanos := h.lastBlockTime.Load()
+	if nanos == 0 {
+		return time.Time{}
 	}
-	h.headBlockTimeCh <- blockTime
+
+	return time.Unix(0, nanos)
+}
+
+// Drift returns how far from real-time the last block time received is, zero if no
+// block time was received yet.
+func (h *HeadTimeDrift) Drift() time.Duration {
+	blockTime := h.LastBlockTime()
+	if blockTime.IsZero() {
+		return 0
+	}
+
+	return h.clock.Since(blockTime)
 }
 
 func (s *Set) NewHeadBlockNumber(service string) *HeadBlockNum {
@@ -77,10 +323,6 @@ type HeadBlockNum struct {
 }
 
 func (h *HeadBlockNum) SetUint64(blockNum uint64) {
+	registerLegacyHeadMetrics()
 	headBlockNumber.WithLabelValues(h.service).Set(float64(blockNum))
 }
-
-func init() {
-	PrometheusRegister(headTimeDriftGauge)
-	PrometheusRegister(headBlockNumber)
-}
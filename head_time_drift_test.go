@@ -0,0 +1,282 @@
+package dmetrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestHeadTimeDrift_Refresh(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	drift := NewSet().NewHeadTimeDrift("head_drift_refresh", DriftRefreshInterval(5*time.Millisecond))
+	drift.Start(context.Background())
+	defer drift.Stop()
+
+	drift.SetBlockTime(time.Now().Add(-time.Hour))
+	initial := testutil.ToFloat64(headTimeDriftGauge.WithLabelValues("head_drift_refresh"))
+	assert.InDelta(t, time.Hour.Seconds(), initial, 1)
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(headTimeDriftGauge.WithLabelValues("head_drift_refresh")) > initial
+	}, time.Second, time.Millisecond, "gauge keeps growing without new blocks")
+}
+
+func TestHeadTimeDrift_ConcurrentSetBlockTime(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	drift := NewSet().NewHeadTimeDrift("head_drift_concurrent")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			drift.SetBlockTime(time.Unix(int64(i), 0))
+		}(i)
+	}
+	wg.Wait()
+
+	// Lazily started by the first `SetBlockTime`, a single goroutine is stopped here
+	drift.Stop()
+	drift.Stop()
+
+	// Never blocks, even once stopped
+	drift.SetBlockTime(time.Now())
+	assert.InDelta(t, 0, drift.Drift().Seconds(), 1)
+}
+
+func TestHeadTimeDrift_ContextCanceled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	drift := NewSet().NewHeadTimeDrift("head_drift_context")
+	drift.Start(ctx)
+
+	cancel()
+	drift.Stop()
+}
+
+func TestHeadTimeDrift_InvalidRefreshInterval(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		drift := NewSet().NewHeadTimeDrift("head_drift_invalid_interval", DriftRefreshInterval(interval))
+		assert.Equal(t, defaultDriftRefreshInterval, drift.refreshInterval)
+
+		drift.Start(context.Background())
+		drift.Stop()
+	}
+}
+
+func TestHeadTimeDrift_RegisterClashingMetrics(t *testing.T) {
+	headStalls.WithLabelValues("head_drift_clashing").Inc()
+	defer headStalls.DeleteLabelValues("head_drift_clashing")
+
+	defer func(register func(...prometheus.Collector)) { PrometheusRegister = register }(PrometheusRegister)
+
+	registerAll := func(trackerFirst bool) []string {
+		registry := prometheus.NewRegistry()
+		PrometheusRegister = registry.MustRegister
+
+		set := NewSet()
+		set.NewHeadTracker("chain").SetBlock(2, "0x02", time.Now(), "ethereum")
+
+		assert.NotPanics(t, func() {
+			if trackerFirst {
+				set.Register()
+				registerHeadMetrics(registry)
+			} else {
+				registerHeadMetrics(registry)
+				set.Register()
+			}
+		})
+
+		families, err := registry.Gather()
+		require.NoError(t, err)
+
+		var names []string
+		for _, family := range families {
+			names = append(names, fmt.Sprintf("%s%v", family.GetName(), labelNames(family.Metric)))
+		}
+		return names
+	}
+
+	// The metrics registered first are exported, the ones not clashing are always exported
+	trackerFirst := registerAll(true)
+	assert.Contains(t, trackerFirst, "head_block_number[chain]")
+	assert.Contains(t, trackerFirst, "head_stalls_total[app]")
+
+	legacyFirst := registerAll(false)
+	assert.NotContains(t, legacyFirst, "head_block_number[chain]")
+	assert.Contains(t, legacyFirst, "head_stalls_total[app]")
+}
+
+func labelNames(metrics []*dto.Metric) []string {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	var names []string
+	for _, pair := range metrics[0].Label {
+		names = append(names, pair.GetName())
+	}
+	return names
+}
+
+func TestHeadTimeDrift_StopBeforeStart(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	drift := NewSet().NewHeadTimeDrift("head_drift_never_started")
+	drift.Stop()
+	drift.Start(context.Background())
+}
+
+func TestHeadTimeDrift_Stall(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	useTestReadinessRegistry(t)
+	headStalls.DeleteLabelValues("head_drift_stall")
+
+	clock := NewFakeClock(time.Unix(1000, 0))
+	app := NewSet().NewAppReadiness("head_drift_stall")
+	app.SetReady()
+
+	stalls := make(chan bool, 1)
+	drift := NewSet(UseClock(clock)).NewHeadTimeDrift("head_drift_stall",
+		DriftRefreshInterval(time.Second),
+		StallTimeout(3*time.Second),
+		StallReadiness(app, ""),
+		OnStall(func(stalled bool) { stalls <- stalled }),
+	)
+	drift.Start(context.Background())
+	defer drift.Stop()
+
+	drift.SetBlockTime(clock.Now())
+	clock.Advance(2 * time.Second)
+	drift.SetBlockTime(clock.Now())
+	clock.Advance(2 * time.Second)
+	assertNoStallChange(t, stalls)
+	assert.True(t, app.IsReady())
+
+	clock.Advance(2 * time.Second)
+	assert.True(t, receiveStallChange(t, stalls))
+	assert.False(t, app.IsReady())
+	assert.Equal(t, "head_stall:head_drift_stall: stalled", app.State().Reason)
+	assert.Equal(t, 1.0, testutil.ToFloat64(headStalls.WithLabelValues("head_drift_stall")))
+
+	drift.SetBlockTime(clock.Now())
+	clock.Advance(time.Second)
+	assert.False(t, receiveStallChange(t, stalls))
+	assert.True(t, app.IsReady())
+}
+
+func TestHeadTimeDrift_StopWhileStalled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	useTestReadinessRegistry(t)
+	headStalls.DeleteLabelValues("head_drift_stop_stalled")
+
+	clock := NewFakeClock(time.Unix(1000, 0))
+	app := NewSet().NewAppReadiness("head_drift_stop_stalled")
+	app.SetReady()
+
+	stalls := make(chan bool, 1)
+	drift := NewSet(UseClock(clock)).NewHeadTimeDrift("head_drift_stop_stalled",
+		DriftRefreshInterval(time.Second),
+		StallTimeout(time.Second),
+		StallReadiness(app, ""),
+		OnStall(func(stalled bool) { stalls <- stalled }),
+	)
+	drift.Start(context.Background())
+
+	clock.Advance(2 * time.Second)
+	assert.True(t, receiveStallChange(t, stalls))
+	assert.False(t, app.IsReady())
+
+	drift.Stop()
+	assert.True(t, app.IsReady())
+	assert.Empty(t, app.Report().Components)
+}
+
+func TestHeadTimeDrift_StallSharedApp(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	useTestReadinessRegistry(t)
+	defer headStalls.DeleteLabelValues("head_drift_shared_1")
+	defer headStalls.DeleteLabelValues("head_drift_shared_2")
+
+	clock := NewFakeClock(time.Unix(1000, 0))
+	app := NewSet().NewAppReadiness("head_drift_shared")
+	app.SetReady()
+
+	// A component not created by the drifts, like the one of a check
+	head := app.Component("head")
+	head.SetReady()
+
+	newDrift := func(service string, timeout time.Duration, componentName string, stalls chan bool) *HeadTimeDrift {
+		drift := NewSet(UseClock(clock)).NewHeadTimeDrift(service,
+			DriftRefreshInterval(time.Second),
+			StallTimeout(timeout),
+			StallReadiness(app, componentName),
+			OnStall(func(stalled bool) { stalls <- stalled }),
+		)
+		drift.Start(context.Background())
+		return drift
+	}
+
+	stalls1, stalls2 := make(chan bool, 1), make(chan bool, 1)
+	drift1 := newDrift("head_drift_shared_1", time.Second, "", stalls1)
+	drift2 := newDrift("head_drift_shared_2", 2*time.Second, "head", stalls2)
+
+	clock.Advance(2 * time.Second)
+	assert.True(t, receiveStallChange(t, stalls1))
+	assert.Equal(t, "head_stall:head_drift_shared_1: stalled", app.State().Reason)
+
+	clock.Advance(time.Second)
+	assert.True(t, receiveStallChange(t, stalls2))
+
+	// Each drift flags its own component, the first recovering leaves the second stalled
+	drift1.SetBlockTime(clock.Now())
+	clock.Advance(time.Second)
+	assert.False(t, receiveStallChange(t, stalls1))
+	assert.Equal(t, "head: stalled", app.State().Reason)
+
+	// The component it did not create is flagged ready but kept
+	drift2.Stop()
+	assert.True(t, app.IsReady())
+	assert.Same(t, head, app.Component("head"))
+
+	drift1.Stop()
+	components := app.Report().Components
+	require.Len(t, components, 1)
+	assert.Equal(t, "head", components[0].Name)
+}
+
+func receiveStallChange(t *testing.T, stalls chan bool) bool {
+	t.Helper()
+
+	select {
+	case stalled := <-stalls:
+		return stalled
+	case <-time.After(time.Second):
+		t.Fatal("expected a stall change")
+		return false
+	}
+}
+
+func assertNoStallChange(t *testing.T, stalls chan bool) {
+	t.Helper()
+
+	select {
+	case stalled := <-stalls:
+		t.Fatalf("unexpected stall change to %t", stalled)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
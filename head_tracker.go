@@ -0,0 +1,165 @@
+package dmetrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var _ prometheus.Collector = (*HeadTracker)(nil)
+
+// HeadTracker tracks the head block of multiple chains or streams followed by the
+// same process, each head being identified by the values of the tracker's labels
+// (e.g. chain and source). It exposes the `head_block_number`,
+// `head_block_timestamp_seconds` and `head_block_time_drift` gauges, prefixed like
+// every other metric of the Set, and is registered with the Set.
+//
+// The drift is computed at collection time, so it keeps growing when no block is
+// received and no background goroutine is needed.
+//
+// ```
+// heads := metricSet.NewHeadTracker("chain", "source")
+// heads.SetBlock(block.Number, block.ID, block.Time, "ethereum", "node-1")
+// ```
+//
+// The metric names are the same as the ones of [HeadTimeDrift] and [HeadBlockNum]
+// but with different labels, use a prefix (see [PrefixNameWith]) if both are used in
+// the same process. Otherwise, whatever the registration order, the metrics
+// registered first are exported and the clashing ones are logged and dropped.
+type HeadTracker struct {
+	clock Clock
+
+	number    *prometheus.GaugeVec
+	timestamp *prometheus.GaugeVec
+	drift     *prometheus.GaugeVec
+
+	lock  sync.RWMutex
+	heads map[string]*trackedHead
+}
+
+// HeadBlock is the head block of one of the chains or streams of a [HeadTracker].
+type HeadBlock struct {
+	Number uint64
+	ID     string
+	Time   time.Time
+}
+
+type trackedHead struct {
+	labels []string
+	block  HeadBlock
+}
+
+func (s *Set) NewHeadTracker(labels ...string) *HeadTracker {
+	number := s.computeMetricName("head_block_number")
+	timestamp := s.computeMetricName("head_block_timestamp_seconds")
+	drift := s.computeMetricName("head_block_time_drift")
+
+	return s.add(&HeadTracker{
+		clock: s.getClock(),
+		number: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: number,
+			Help: "Number of the head block",
+		}, labels),
+		timestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: timestamp,
+			Help: "Unix timestamp in seconds of the head block",
+		}, labels),
+		drift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: drift,
+			Help: "Number of seconds away from real-time",
+		}, labels),
+		heads: map[string]*trackedHead{},
+	}).(*HeadTracker)
+}
+
+// SetBlock records the head block of the chain or stream identified by the label
+// values.
+func (t *HeadTracker) SetBlock(number uint64, id string, blockTime time.Time, labels ...string) {
+	key := strings.Join(labels, "\xff")
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.heads[key] = &trackedHead{
+		labels: append([]string(nil), labels...),
+		block:  HeadBlock{Number: number, ID: id, Time: blockTime},
+	}
+
+	t.number.WithLabelValues(labels...).Set(float64(number))
+	t.timestamp.WithLabelValues(labels...).Set(float64(blockTime.UnixNano()) / float64(time.Second))
+}
+
+// Head returns the head block of the chain or stream identified by the label values,
+// if any was recorded.
+func (t *HeadTracker) Head(labels ...string) (HeadBlock, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	head, found := t.heads[strings.Join(labels, "\xff")]
+	if !found {
+		return HeadBlock{}, false
+	}
+
+	return head.block, true
+}
+
+// Drift returns how far from real-time the head block of the chain or stream
+// identified by the label values is, zero if no block was recorded.
+func (t *HeadTracker) Drift(labels ...string) time.Duration {
+	head, found := t.Head(labels...)
+	if !found {
+		return 0
+	}
+
+	return t.clock.Since(head.Time)
+}
+
+// DeleteLabelValues stops tracking the chain or stream identified by the label values.
+func (t *HeadTracker) DeleteLabelValues(labels ...string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.heads, strings.Join(labels, "\xff"))
+	t.number.DeleteLabelValues(labels...)
+	t.timestamp.DeleteLabelValues(labels...)
+	t.drift.DeleteLabelValues(labels...)
+}
+
+// register registers the tracker through [PrometheusRegister] without panicking when
+// its metrics clash with the legacy head metrics, see [registerHeadMetrics] for the
+// reverse order.
+func (t *HeadTracker) register() {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+
+			zlog.Warn("unable to register head tracker metrics, they will not be exported", zap.Error(err))
+		}
+	}()
+
+	PrometheusRegister(t)
+}
+
+func (t *HeadTracker) Describe(in chan<- *prometheus.Desc) {
+	t.number.Describe(in)
+	t.timestamp.Describe(in)
+	t.drift.Describe(in)
+}
+
+func (t *HeadTracker) Collect(in chan<- prometheus.Metric) {
+	t.lock.RLock()
+	for _, head := range t.heads {
+		t.drift.WithLabelValues(head.labels...).Set(t.clock.Since(head.block.Time).Seconds())
+	}
+	t.lock.RUnlock()
+
+	t.number.Collect(in)
+	t.timestamp.Collect(in)
+	t.drift.Collect(in)
+}
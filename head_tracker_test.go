@@ -0,0 +1,67 @@
+package dmetrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadTracker(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	set := NewSet(UseClock(clock))
+	heads := set.NewHeadTracker("chain", "source")
+
+	heads.SetBlock(100, "0xaa", time.Unix(990, 0), "ethereum", "node-1")
+	heads.SetBlock(98, "0xbb", time.Unix(980, 0), "ethereum", "node-2")
+	heads.SetBlock(5000, "0xcc", time.Unix(999, 500000000), "polygon", "node-1")
+
+	head, found := heads.Head("ethereum", "node-1")
+	require.True(t, found)
+	assert.Equal(t, HeadBlock{Number: 100, ID: "0xaa", Time: time.Unix(990, 0)}, head)
+	assert.Equal(t, 10*time.Second, heads.Drift("ethereum", "node-1"))
+
+	_, found = heads.Head("polygon", "node-2")
+	assert.False(t, found)
+
+	heads.DeleteLabelValues("ethereum", "node-2")
+	clock.Advance(5 * time.Second)
+
+	expected := `
+		# HELP head_block_number Number of the head block
+		# TYPE head_block_number gauge
+		head_block_number{chain="ethereum",source="node-1"} 100
+		head_block_number{chain="polygon",source="node-1"} 5000
+		# HELP head_block_time_drift Number of seconds away from real-time
+		# TYPE head_block_time_drift gauge
+		head_block_time_drift{chain="ethereum",source="node-1"} 15
+		head_block_time_drift{chain="polygon",source="node-1"} 5.5
+		# HELP head_block_timestamp_seconds Unix timestamp in seconds of the head block
+		# TYPE head_block_timestamp_seconds gauge
+		head_block_timestamp_seconds{chain="ethereum",source="node-1"} 990
+		head_block_timestamp_seconds{chain="polygon",source="node-1"} 999.5
+	`
+
+	assert.NoError(t, testutil.GatherAndCompare(MustNewRegistry(set), strings.NewReader(expected)))
+}
+
+func TestHeadTracker_Prefixed(t *testing.T) {
+	collector := hookTestRegister()
+
+	set := NewSet(PrefixNameWith("indexer"))
+	heads := set.NewHeadTracker("chain")
+	heads.SetBlock(1, "0x01", time.Now(), "ethereum")
+
+	set.Register()
+	assert.Equal(t, 1, collector.count())
+
+	expected := `
+		# HELP indexer_head_block_number Number of the head block
+		# TYPE indexer_head_block_number gauge
+		indexer_head_block_number{chain="ethereum"} 1
+	`
+	assert.NoError(t, testutil.GatherAndCompare(MustNewRegistry(set), strings.NewReader(expected), "indexer_head_block_number"))
+}
@@ -15,16 +15,64 @@
 package dmetrics
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
 func Serve(addr string) {
-	serve := http.Server{Handler: promhttp.Handler(), Addr: addr}
+	serve := http.Server{Handler: Handler(), Addr: addr}
 	if err := serve.ListenAndServe(); err != nil {
 		// It's common enough in development that we are good if it doesn't print
 		zlog.Debug("can't listen on the metrics endpoint", zap.Error(err), zap.String("listen_addr", addr))
 	}
 }
+
+// Handler returns the HTTP handler serving the metrics of the default Prometheus
+// registry. The exposition format is negotiated with the scraper, OpenMetrics being
+// served when requested, which is required for exemplars to be exposed.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	)
+}
+
+// ReadinessHandler returns an HTTP handler serving the readiness of the process as
+// JSON (see [Readiness]). It responds with status 200 when the process is ready and
+// 503 otherwise, so it can be used directly as a Kubernetes readiness probe.
+func ReadinessHandler() http.Handler {
+	return probeHandler(func(report ReadinessReport) bool { return report.Ready })
+}
+
+// StartupHandler is like [ReadinessHandler] but responds with status 200 once all
+// the apps completed their startup phase, to be used as a Kubernetes startup probe.
+func StartupHandler() http.Handler {
+	return probeHandler(func(report ReadinessReport) bool { return report.Started })
+}
+
+// LivenessHandler is like [ReadinessHandler] but responds with status 200 when all
+// the apps are live, to be used as a Kubernetes liveness probe.
+func LivenessHandler() http.Handler {
+	return probeHandler(func(report ReadinessReport) bool { return report.Live })
+}
+
+func probeHandler(passing func(report ReadinessReport) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := Readiness()
+
+		w.Header().Set("Content-Type", "application/json")
+		if passing(report) {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			zlog.Debug("unable to write readiness report", zap.Error(err))
+		}
+	})
+}
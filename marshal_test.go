@@ -0,0 +1,79 @@
+package dmetrics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCounters_MarshalJSON(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+
+	rate := NewRateCounter(time.Second, "blocks")
+	rate.IncBy(5)
+
+	avg := NewAvgCounter(time.Minute, "cache hits")
+	avg.IncBy(4)
+
+	duration := NewAvgDurationCounter(30*time.Second, time.Second, "per block")
+	duration.AddDuration(1500 * time.Millisecond)
+
+	avgRate := MustNewAvgRateCounter(time.Second, 3*time.Second, "blocks", CounterClock(clock))
+	defer avgRate.Stop()
+
+	promBlocks := prometheus.NewCounter(prometheus.CounterOpts{Name: "blocks"})
+	promRate := MustNewAvgRateFromPromCounter(promBlocks, time.Second, 3*time.Second, "blocks", CounterClock(clock))
+	defer promRate.Stop()
+
+	// Not enough samples yet, the rate is 0 so the output stays valid JSON
+	out, err := json.Marshal(avgRate)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"rate":0,"total":0,"unit":"blocks","window_seconds":1,"period_seconds":3}`, string(out))
+
+	for i := 0; i < 2; i++ {
+		avgRate.Add(2)
+		promBlocks.Add(1.5)
+		avgRate.SyncNow()
+		promRate.SyncNow()
+	}
+
+	counters := map[string]json.Marshaler{
+		"rate":      rate,
+		"avg":       avg,
+		"duration":  duration,
+		"avg_rate":  avgRate,
+		"prom_rate": promRate,
+	}
+
+	out, err = json.Marshal(counters)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"rate": {"rate":5,"total":5,"unit":"blocks","window_seconds":1},
+		"avg": {"average":4,"total":4,"description":"cache hits","window_seconds":60},
+		"duration": {"average_seconds":1.5,"total_seconds":1.5,"description":"per block","window_seconds":30},
+		"avg_rate": {"rate":2,"total":4,"unit":"blocks","window_seconds":1,"period_seconds":3},
+		"prom_rate": {"rate":1.5,"total":3,"unit":"blocks","window_seconds":1,"period_seconds":3}
+	}`, string(out))
+}
+
+func TestCounters_MarshalLogObject(t *testing.T) {
+	counter := MustNewEWMARateCounter(time.Second, time.Minute, "blocks", CounterClock(NewFakeClock(time.Unix(0, 0))))
+	defer counter.Stop()
+
+	counter.Add(3)
+	counter.SyncNow()
+
+	encoder := zapcore.NewMapObjectEncoder()
+	require.NoError(t, counter.MarshalLogObject(encoder))
+	assert.Equal(t, map[string]interface{}{"rate": 3.0, "total": uint64(3), "unit": "blocks", "window_seconds": 1.0, "decay_seconds": 60.0}, encoder.Fields)
+
+	percentiles := MustNewPercentileDurationCounter(time.Second, 2*time.Second, 0, CounterClock(NewFakeClock(time.Unix(0, 0))))
+	out, err := json.Marshal(percentiles)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"p50_seconds":0,"p90_seconds":0,"p99_seconds":0,"window_seconds":1,"period_seconds":2}`, string(out))
+}
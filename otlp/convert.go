@@ -0,0 +1,149 @@
+package otlp
+
+import (
+	"math"
+
+	dto "github.com/prometheus/client_model/go"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// familiesToMetrics converts the gathered metric families into OTLP metrics. Counters
+// become monotonic cumulative sums, gauges (and untyped) become gauges, histograms
+// become cumulative explicit-bucket histograms and summaries stay summaries.
+func familiesToMetrics(families []*dto.MetricFamily, startTime uint64, now uint64) (out []*metricspb.Metric) {
+	for _, family := range families {
+		metric := &metricspb.Metric{
+			Name:        family.GetName(),
+			Description: family.GetHelp(),
+		}
+
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			sum := &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}
+			for _, m := range family.Metric {
+				sum.DataPoints = append(sum.DataPoints, numberDataPoint(m, m.GetCounter().GetValue(), startTime, now))
+			}
+			metric.Data = &metricspb.Metric_Sum{Sum: sum}
+
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			gauge := &metricspb.Gauge{}
+			for _, m := range family.Metric {
+				value := m.GetGauge().GetValue()
+				if family.GetType() == dto.MetricType_UNTYPED {
+					value = m.GetUntyped().GetValue()
+				}
+
+				// Gauges have no start time, they are instant values
+				gauge.DataPoints = append(gauge.DataPoints, numberDataPoint(m, value, 0, now))
+			}
+			metric.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+
+		case dto.MetricType_HISTOGRAM:
+			histogram := &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			}
+			for _, m := range family.Metric {
+				histogram.DataPoints = append(histogram.DataPoints, histogramDataPoint(m, startTime, now))
+			}
+			metric.Data = &metricspb.Metric_Histogram{Histogram: histogram}
+
+		case dto.MetricType_SUMMARY:
+			summary := &metricspb.Summary{}
+			for _, m := range family.Metric {
+				point := &metricspb.SummaryDataPoint{
+					Attributes:        attributes(m.Label),
+					StartTimeUnixNano: startTime,
+					TimeUnixNano:      timestamp(m, now),
+					Count:             m.GetSummary().GetSampleCount(),
+					Sum:               m.GetSummary().GetSampleSum(),
+				}
+				for _, quantile := range m.GetSummary().Quantile {
+					point.QuantileValues = append(point.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+						Quantile: quantile.GetQuantile(),
+						Value:    quantile.GetValue(),
+					})
+				}
+				summary.DataPoints = append(summary.DataPoints, point)
+			}
+			metric.Data = &metricspb.Metric_Summary{Summary: summary}
+
+		default:
+			continue
+		}
+
+		out = append(out, metric)
+	}
+
+	return out
+}
+
+func numberDataPoint(m *dto.Metric, value float64, startTime uint64, now uint64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        attributes(m.Label),
+		StartTimeUnixNano: startTime,
+		TimeUnixNano:      timestamp(m, now),
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+// histogramDataPoint converts Prometheus cumulative buckets into OTLP buckets, OTLP
+// counts are per bucket and there is always one more count than there is bounds, the
+// last one being the implicit `+Inf` bucket.
+func histogramDataPoint(m *dto.Metric, startTime uint64, now uint64) *metricspb.HistogramDataPoint {
+	histogram := m.GetHistogram()
+	sum := histogram.GetSampleSum()
+
+	point := &metricspb.HistogramDataPoint{
+		Attributes:        attributes(m.Label),
+		StartTimeUnixNano: startTime,
+		TimeUnixNano:      timestamp(m, now),
+		Count:             histogram.GetSampleCount(),
+		Sum:               &sum,
+	}
+
+	previous := uint64(0)
+	for _, bucket := range histogram.Bucket {
+		if math.IsInf(bucket.GetUpperBound(), +1) {
+			continue
+		}
+
+		point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, bucket.GetCumulativeCount()-previous)
+		previous = bucket.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, histogram.GetSampleCount()-previous)
+
+	return point
+}
+
+func attributes(pairs []*dto.LabelPair) []*commonpb.KeyValue {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	out := make([]*commonpb.KeyValue, len(pairs))
+	for i, pair := range pairs {
+		out[i] = stringAttribute(pair.GetName(), pair.GetValue())
+	}
+
+	return out
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func timestamp(m *dto.Metric, now uint64) uint64 {
+	if m.TimestampMs != nil {
+		return uint64(m.GetTimestampMs()) * 1e6
+	}
+
+	return now
+}
@@ -0,0 +1,220 @@
+// Package otlp implements a bridge periodically pushing the metrics of a Prometheus
+// gatherer to an OpenTelemetry collector using OTLP over HTTP with protobuf encoding.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const scopeName = "github.com/streamingfast/dmetrics"
+
+// Exporter gathers the metrics at a fixed interval and pushes them to the OTLP HTTP
+// endpoint of an OpenTelemetry collector, usually `http://<collector>:4318/v1/metrics`.
+//
+// ```
+// exporter := otlp.NewExporter("http://otel-collector:4318/v1/metrics", dmetrics.MustNewRegistry(bstream.MetricsSet), otlp.ServiceName("firehose"))
+// exporter.Start(ctx)
+// defer exporter.Close()
+// ```
+type Exporter struct {
+	endpoint           string
+	gatherer           prometheus.Gatherer
+	client             *http.Client
+	headers            http.Header
+	interval           time.Duration
+	resourceAttributes []*commonpb.KeyValue
+	startTime          time.Time
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+	closeErr  error
+}
+
+type Option func(e *Exporter)
+
+// ServiceName sets the `service.name` resource attribute.
+func ServiceName(name string) Option {
+	return ResourceAttribute("service.name", name)
+}
+
+// ServiceVersion sets the `service.version` resource attribute.
+func ServiceVersion(version string) Option {
+	return ResourceAttribute("service.version", version)
+}
+
+// ResourceAttribute adds an attribute describing the resource producing the metrics,
+// can be used multiple times to define multiple attributes.
+func ResourceAttribute(key, value string) Option {
+	return func(e *Exporter) {
+		for _, attribute := range e.resourceAttributes {
+			if attribute.Key == key {
+				attribute.Value = stringAttribute(key, value).Value
+				return
+			}
+		}
+
+		e.resourceAttributes = append(e.resourceAttributes, stringAttribute(key, value))
+	}
+}
+
+const defaultInterval = 30 * time.Second
+
+// Interval configures at which interval the metrics are gathered and pushed, defaults to 30s.
+// A zero or negative interval keeps the default.
+func Interval(interval time.Duration) Option {
+	return func(e *Exporter) {
+		e.interval = interval
+	}
+}
+
+// HTTPClient configures the HTTP client used to talk to the collector.
+func HTTPClient(client *http.Client) Option {
+	return func(e *Exporter) {
+		e.client = client
+	}
+}
+
+// Header adds a header to every request sent to the collector, useful for authentication.
+func Header(name, value string) Option {
+	return func(e *Exporter) {
+		e.headers.Add(name, value)
+	}
+}
+
+// NewExporter creates an [Exporter] pushing the metrics of the gatherer to the given
+// OTLP HTTP endpoint, use `dmetrics.NewRegistry` to push the metrics of one or more
+// `dmetrics.Set`.
+func NewExporter(endpoint string, gatherer prometheus.Gatherer, options ...Option) *Exporter {
+	e := &Exporter{
+		endpoint:  endpoint,
+		gatherer:  gatherer,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		headers:   http.Header{},
+		interval:  defaultInterval,
+		startTime: time.Now(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(e)
+	}
+
+	if e.interval <= 0 {
+		e.interval = defaultInterval
+	}
+
+	return e
+}
+
+// Start launches the background goroutine pushing the metrics at the configured
+// interval. Pushing stops when the context is canceled or when [Exporter.Close] is
+// called, whichever comes first.
+func (e *Exporter) Start(ctx context.Context) {
+	e.startOnce.Do(func() {
+		go e.run(ctx)
+	})
+}
+
+func (e *Exporter) run(ctx context.Context) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.Export(); err != nil {
+				zlog.Warn("unable to export metrics to otlp endpoint", zap.String("endpoint", e.endpoint), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Close stops the periodic pushes and performs a final push, the error of the final
+// push, if any, is returned.
+func (e *Exporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.stop)
+
+		// Ensures no more push can be started by the background goroutine
+		e.startOnce.Do(func() { close(e.done) })
+		<-e.done
+
+		e.closeErr = e.Export()
+	})
+
+	return e.closeErr
+}
+
+// Export gathers the metrics and pushes them right now.
+func (e *Exporter) Export() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+
+	metrics := familiesToMetrics(families, uint64(e.startTime.UnixNano()), uint64(time.Now().UnixNano()))
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	payload, err := proto.Marshal(&collectorpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: e.resourceAttributes},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: scopeName},
+				Metrics: metrics,
+			}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+
+	for name, values := range e.headers {
+		request.Header[name] = values
+	}
+	request.Header.Set("Content-Type", "application/x-protobuf")
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("unexpected status code %d from %s: %s", response.StatusCode, e.endpoint, bytes.TrimSpace(body))
+	}
+
+	io.Copy(ioutil.Discard, response.Body)
+	return nil
+}
@@ -0,0 +1,143 @@
+package otlp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type testReceiver struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	requests []*collectorpb.ExportMetricsServiceRequest
+}
+
+func newTestReceiver(t *testing.T) *testReceiver {
+	r := &testReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/metrics", req.URL.Path)
+		assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+
+		payload, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		request := &collectorpb.ExportMetricsServiceRequest{}
+		require.NoError(t, proto.Unmarshal(payload, request))
+
+		r.lock.Lock()
+		r.requests = append(r.requests, request)
+		r.lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return r
+}
+
+func (r *testReceiver) received() []*collectorpb.ExportMetricsServiceRequest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]*collectorpb.ExportMetricsServiceRequest(nil), r.requests...)
+}
+
+func TestExporter_Export(t *testing.T) {
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks", Help: "Processed blocks"}, []string{"source"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "head"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency", Buckets: []float64{1, 5}})
+	registry.MustRegister(counter, gauge, histogram)
+
+	counter.WithLabelValues("a").Add(3)
+	gauge.Set(42)
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+	histogram.Observe(10)
+
+	exporter := NewExporter(receiver.URL+"/v1/metrics", registry, ServiceName("firehose"), ServiceVersion("v1.2.3"))
+	require.NoError(t, exporter.Export())
+
+	requests := receiver.received()
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0].ResourceMetrics, 1)
+
+	resourceMetrics := requests[0].ResourceMetrics[0]
+	resource := map[string]string{}
+	for _, attribute := range resourceMetrics.Resource.Attributes {
+		resource[attribute.Key] = attribute.Value.GetStringValue()
+	}
+	assert.Equal(t, map[string]string{"service.name": "firehose", "service.version": "v1.2.3"}, resource)
+
+	require.Len(t, resourceMetrics.ScopeMetrics, 1)
+	metrics := map[string]*metricspb.Metric{}
+	for _, metric := range resourceMetrics.ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+	require.Len(t, metrics, 3)
+
+	sum := metrics["blocks"].GetSum()
+	require.NotNil(t, sum)
+	assert.Equal(t, "Processed blocks", metrics["blocks"].Description)
+	assert.True(t, sum.IsMonotonic)
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.AggregationTemporality)
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, 3.0, sum.DataPoints[0].GetAsDouble())
+	assert.Equal(t, "source", sum.DataPoints[0].Attributes[0].Key)
+	assert.Equal(t, "a", sum.DataPoints[0].Attributes[0].Value.GetStringValue())
+	assert.NotZero(t, sum.DataPoints[0].StartTimeUnixNano)
+
+	gaugeMetric := metrics["head"].GetGauge()
+	require.NotNil(t, gaugeMetric)
+	require.Len(t, gaugeMetric.DataPoints, 1)
+	assert.Equal(t, 42.0, gaugeMetric.DataPoints[0].GetAsDouble())
+
+	histogramMetric := metrics["latency"].GetHistogram()
+	require.NotNil(t, histogramMetric)
+	require.Len(t, histogramMetric.DataPoints, 1)
+	point := histogramMetric.DataPoints[0]
+	assert.EqualValues(t, 3, point.Count)
+	assert.Equal(t, 12.5, point.GetSum())
+	assert.Equal(t, []float64{1, 5}, point.ExplicitBounds)
+	assert.Equal(t, []uint64{1, 1, 1}, point.BucketCounts)
+}
+
+func TestExporter_Periodic(t *testing.T) {
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge"}))
+
+	exporter := NewExporter(receiver.URL+"/v1/metrics", registry, Interval(10*time.Millisecond))
+	exporter.Start(context.Background())
+
+	require.Eventually(t, func() bool { return len(receiver.received()) >= 2 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, exporter.Close())
+
+	count := len(receiver.received())
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, count, len(receiver.received()), "no push should happen after close")
+}
+
+func TestExporter_InvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		exporter := NewExporter("http://localhost:4318/v1/metrics", prometheus.NewRegistry(), Interval(interval))
+		assert.Equal(t, defaultInterval, exporter.interval)
+	}
+}
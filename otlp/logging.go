@@ -0,0 +1,7 @@
+package otlp
+
+import (
+	"github.com/streamingfast/logging"
+)
+
+var zlog, _ = logging.PackageLogger("otlp", "github.com/streamingfast/dmetrics/otlp")
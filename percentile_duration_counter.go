@@ -0,0 +1,248 @@
+package dmetrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// percentileRelativeAccuracy is the maximum relative error of the quantiles computed
+// by [PercentileDurationCounter], it bounds the number of buckets of each sketch to a
+// few thousands whatever the number of durations added.
+const percentileRelativeAccuracy = 0.01
+
+var percentileGamma = (1 + percentileRelativeAccuracy) / (1 - percentileRelativeAccuracy)
+var percentileLogGamma = math.Log(percentileGamma)
+
+// PercentileDurationCounter is safe for concurrent use.
+type PercentileDurationCounter struct {
+	samplingWindow time.Duration
+	period         time.Duration
+	unit           time.Duration
+	clock          Clock
+
+	lock     sync.Mutex
+	sketches []*durationSketch
+}
+
+// MustNewPercentileDurationCounter acts like [NewPercentileDurationCounter] but panics if an error occurs.
+func MustNewPercentileDurationCounter(samplingWindow time.Duration, period time.Duration, unit time.Duration, options ...CounterOption) *PercentileDurationCounter {
+	c, err := NewPercentileDurationCounter(samplingWindow, period, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewPercentileDurationCounter allows you to get the percentiles of the elapsed time
+// of a given process over a period of time, for example the tail latencies of the
+// requests served in the last 30s.
+//
+// The durations are accumulated in a sketch per <samplingWindow>, the sketches of the
+// whole <period> being merged to compute a quantile, the oldest one being dropped as
+// the window moves. A sketch groups the durations in logarithmic buckets, so the
+// quantiles are within 1% of the actual value and the memory used is bounded
+// whatever the number of durations added.
+//
+// ```
+// counter := MustNewPercentileDurationCounter(time.Second, 30*time.Second, time.Millisecond)
+// counter.AddDuration(12 * time.Millisecond)
+// counter.AddDuration(340 * time.Millisecond)
+//
+// counter.String() == p50=11.88ms p90=342.10ms p99=342.10ms (over 30s)
+// ```
+//
+// The `unit` parameter can be 0, in which case the unit of each quantile is inferred
+// like [NewAvgDurationCounter] does.
+func NewPercentileDurationCounter(samplingWindow time.Duration, period time.Duration, unit time.Duration, options ...CounterOption) (*PercentileDurationCounter, error) {
+	if samplingWindow <= 0 {
+		return nil, fmt.Errorf("sampling window must be greater then 0")
+	}
+
+	if samplingWindow > period {
+		return nil, fmt.Errorf("interval (%s) must be lower than averageTime (%s) but it's not", samplingWindow, period)
+	}
+
+	if period%samplingWindow != 0 {
+		return nil, fmt.Errorf("averageTime (%s) must be divisible by samplingWindow (%s) without a remainder but it's not", period, samplingWindow)
+	}
+
+	sketches := make([]*durationSketch, period/samplingWindow)
+	for i := range sketches {
+		sketches[i] = newDurationSketch()
+	}
+
+	return &PercentileDurationCounter{
+		samplingWindow: samplingWindow,
+		period:         period,
+		unit:           unit,
+		clock:          newCounterOptions(options).clock,
+		sketches:       sketches,
+	}, nil
+}
+
+func (c *PercentileDurationCounter) AddElapsedTime(start time.Time) {
+	c.AddDuration(c.clock.Since(start))
+}
+
+func (c *PercentileDurationCounter) AddDuration(dur time.Duration) {
+	window := c.window()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	sketch := c.sketches[window%int64(len(c.sketches))]
+	if sketch.window != window {
+		// The sketch was for a window that fell out of the period
+		sketch.reset(window)
+	}
+
+	sketch.add(dur)
+}
+
+// Quantile returns the duration under which the fraction <q> (between 0 and 1) of
+// the durations added during the period fall, 0 if none were added.
+func (c *PercentileDurationCounter) Quantile(q float64) time.Duration {
+	return c.Quantiles(q)[0]
+}
+
+// Quantiles acts like [PercentileDurationCounter.Quantile] for multiple quantiles at
+// once, merging the sketches of the period only once.
+func (c *PercentileDurationCounter) Quantiles(qs ...float64) []time.Duration {
+	merged := c.merged()
+
+	out := make([]time.Duration, len(qs))
+	for i, q := range qs {
+		out[i] = merged.quantile(q)
+	}
+
+	return out
+}
+
+func (c *PercentileDurationCounter) String() string {
+	qs := []float64{0.5, 0.9, 0.99}
+	values := c.Quantiles(qs...)
+
+	parts := make([]string, len(qs))
+	for i, q := range qs {
+		parts[i] = fmt.Sprintf("p%s=%s", formatPercentile(q), durationToString(values[i], c.unit))
+	}
+
+	return fmt.Sprintf("%s (over %s)", strings.Join(parts, " "), samplingWindowToString(c.period))
+}
+
+// MarshalLogObject logs the `p50_seconds`, `p90_seconds`, `p99_seconds`,
+// `window_seconds` and `period_seconds` fields.
+func (c *PercentileDurationCounter) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	values := c.Quantiles(0.5, 0.9, 0.99)
+	enc.AddFloat64("p50_seconds", values[0].Seconds())
+	enc.AddFloat64("p90_seconds", values[1].Seconds())
+	enc.AddFloat64("p99_seconds", values[2].Seconds())
+	enc.AddFloat64("window_seconds", c.samplingWindow.Seconds())
+	enc.AddFloat64("period_seconds", c.period.Seconds())
+	return nil
+}
+
+func (c *PercentileDurationCounter) MarshalJSON() ([]byte, error) {
+	return marshalObjectJSON(c)
+}
+
+func (c *PercentileDurationCounter) window() int64 {
+	return c.clock.Now().UnixNano() / int64(c.samplingWindow)
+}
+
+// merged returns a sketch holding the durations added in the windows of the period
+func (c *PercentileDurationCounter) merged() *durationSketch {
+	oldest := c.window() - int64(len(c.sketches)) + 1
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := newDurationSketch()
+	for _, sketch := range c.sketches {
+		if sketch.window >= oldest {
+			out.merge(sketch)
+		}
+	}
+
+	return out
+}
+
+// durationSketch counts durations in buckets whose bounds grow exponentially by a
+// factor of gamma, the bucket `i` holding the durations in `(gamma^(i-1), gamma^i]`.
+type durationSketch struct {
+	window  int64
+	buckets map[int]uint64
+	zeros   uint64
+	count   uint64
+}
+
+func newDurationSketch() *durationSketch {
+	return &durationSketch{window: math.MinInt64, buckets: map[int]uint64{}}
+}
+
+func (s *durationSketch) reset(window int64) {
+	s.window = window
+	s.buckets = map[int]uint64{}
+	s.zeros = 0
+	s.count = 0
+}
+
+func (s *durationSketch) add(dur time.Duration) {
+	s.count++
+	if dur <= 0 {
+		s.zeros++
+		return
+	}
+
+	s.buckets[int(math.Ceil(math.Log(float64(dur))/percentileLogGamma))]++
+}
+
+func (s *durationSketch) merge(other *durationSketch) {
+	for index, count := range other.buckets {
+		s.buckets[index] += count
+	}
+
+	s.zeros += other.zeros
+	s.count += other.count
+}
+
+func (s *durationSketch) quantile(q float64) time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+
+	// Nearest rank, the rank being 0 based
+	q = math.Max(0, math.Min(1, q))
+	rank := uint64(math.Max(0, math.Ceil(q*float64(s.count))-1))
+	if rank < s.zeros {
+		return 0
+	}
+
+	indexes := make([]int, 0, len(s.buckets))
+	for index := range s.buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	seen := s.zeros
+	for _, index := range indexes {
+		seen += s.buckets[index]
+		if seen > rank {
+			// The middle of the bucket, relative to its bounds, minimizes the relative error
+			return time.Duration(math.Round(2 * math.Pow(percentileGamma, float64(index)) / (percentileGamma + 1)))
+		}
+	}
+
+	// Unreachable, the buckets count for all the non zero durations
+	return 0
+}
+
+func formatPercentile(q float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%f", q*100), "0"), ".")
+}
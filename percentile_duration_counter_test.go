@@ -0,0 +1,73 @@
+package dmetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentileDurationCounter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	counter := MustNewPercentileDurationCounter(time.Second, 3*time.Second, time.Millisecond, CounterClock(clock))
+
+	assert.Equal(t, time.Duration(0), counter.Quantile(0.5))
+
+	for i := 1; i <= 1000; i++ {
+		counter.AddDuration(time.Duration(i) * time.Millisecond)
+	}
+
+	for q, expected := range map[float64]time.Duration{0: time.Millisecond, 0.5: 500 * time.Millisecond, 0.9: 900 * time.Millisecond, 0.99: 990 * time.Millisecond, 1: time.Second} {
+		assert.InEpsilon(t, expected, counter.Quantile(q), percentileRelativeAccuracy, "quantile %f", q)
+	}
+
+	assert.Equal(t, "p50=500.25ms p90=893.48ms p99=987.45ms (over 3s)", counter.String())
+}
+
+func TestPercentileDurationCounter_WindowMoves(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	counter := MustNewPercentileDurationCounter(time.Second, 2*time.Second, 0, CounterClock(clock))
+
+	counter.AddDuration(time.Second)
+	counter.AddDuration(time.Second)
+	clock.Advance(time.Second)
+	counter.AddDuration(10 * time.Millisecond)
+	counter.AddElapsedTime(clock.Now().Add(-10 * time.Millisecond))
+
+	assert.InEpsilon(t, 10*time.Millisecond, counter.Quantile(0.25), percentileRelativeAccuracy)
+	assert.InEpsilon(t, time.Second, counter.Quantile(0.75), percentileRelativeAccuracy)
+
+	// The first second falls out of the period
+	clock.Advance(time.Second)
+	assert.InEpsilon(t, 10*time.Millisecond, counter.Quantile(0.75), percentileRelativeAccuracy)
+
+	clock.Advance(time.Second)
+	assert.Equal(t, time.Duration(0), counter.Quantile(0.99))
+	assert.Equal(t, "p50=0ns p90=0ns p99=0ns (over 2s)", counter.String())
+
+	// Sketches are reused once their window fell out of the period
+	counter.AddDuration(0)
+	counter.AddDuration(5 * time.Microsecond)
+	assert.Equal(t, time.Duration(0), counter.Quantile(0))
+	assert.InEpsilon(t, 5*time.Microsecond, counter.Quantile(1), percentileRelativeAccuracy)
+}
+
+func TestPercentileDurationCounter_BoundedMemory(t *testing.T) {
+	counter := MustNewPercentileDurationCounter(time.Second, time.Second, 0, CounterClock(NewFakeClock(time.Unix(0, 0))))
+
+	for i := 0; i < 100000; i++ {
+		counter.AddDuration(time.Duration(i) * time.Microsecond)
+	}
+
+	// From 1µs to 100ms, that is log(1e8/1e3)/log(gamma) buckets
+	assert.LessOrEqual(t, len(counter.sketches[0].buckets), 600)
+}
+
+func TestPercentileDurationCounter_Validation(t *testing.T) {
+	_, err := NewPercentileDurationCounter(0, time.Second, 0)
+	require.Error(t, err)
+
+	_, err = NewPercentileDurationCounter(2*time.Second, 3*time.Second, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dmetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+// appProbes holds the startup and liveness state of an app, kept apart from the
+// readiness state as heartbeats are frequent and must stay cheap.
+type appProbes struct {
+	startedAt        *atomic.Int64
+	heartbeatTimeout *atomic.Int64
+	lastHeartbeat    *atomic.Int64
+}
+
+func newAppProbes() appProbes {
+	return appProbes{
+		startedAt:        atomic.NewInt64(0),
+		heartbeatTimeout: atomic.NewInt64(0),
+		lastHeartbeat:    atomic.NewInt64(0),
+	}
+}
+
+// MarkStarted flags the startup phase of the app as complete, typically once it
+// caught up with the chain head. Calling it multiple times has no effect.
+func (a *AppReadiness) MarkStarted() {
+	a.probes.startedAt.CAS(0, time.Now().UnixNano())
+}
+
+// IsStarted returns true once the startup phase of the app is complete, see
+// [AppReadiness.MarkStarted].
+func (a *AppReadiness) IsStarted() bool {
+	return a.probes.startedAt.Load() != 0
+}
+
+// SetHeartbeatTimeout derives the liveness of the app from heartbeats, the app is
+// not live when no heartbeat was received in the last `timeout`. A timeout of 0,
+// the default, disables the heartbeat tracking, the app being always live.
+//
+// Liveness is not enforced during the startup phase, which can be long for apps
+// catching up, and the timeout only counts from the end of the startup phase, which
+// acts as a grace period for the first heartbeat.
+func (a *AppReadiness) SetHeartbeatTimeout(timeout time.Duration) {
+	a.probes.heartbeatTimeout.Store(int64(timeout))
+}
+
+// Heartbeat records that the app is making progress, see [AppReadiness.SetHeartbeatTimeout].
+func (a *AppReadiness) Heartbeat() {
+	a.probes.lastHeartbeat.Store(time.Now().UnixNano())
+}
+
+// IsLive returns false when the app stopped sending heartbeats for longer than the
+// heartbeat timeout, true otherwise.
+func (a *AppReadiness) IsLive() bool {
+	startedAt := a.probes.startedAt.Load()
+	timeout := a.probes.heartbeatTimeout.Load()
+	if startedAt == 0 || timeout == 0 {
+		return true
+	}
+
+	last := a.probes.lastHeartbeat.Load()
+	if last < startedAt {
+		last = startedAt
+	}
+
+	return time.Since(time.Unix(0, last)) <= time.Duration(timeout)
+}
+
+// IsStarted returns true if all the apps of the process completed their startup
+// phase, a process without any app is considered started.
+func IsStarted() bool {
+	for _, app := range readinessRegistry.list() {
+		if !app.IsStarted() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsLive returns true if all the apps of the process are live, a process without
+// any app is considered live.
+func IsLive() bool {
+	for _, app := range readinessRegistry.list() {
+		if !app.IsLive() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// probesCollector exposes the startup and liveness of every app, liveness depends on
+// the time elapsed since the last heartbeat so it is computed at collection time.
+type probesCollector struct {
+	started *prometheus.Desc
+	live    *prometheus.Desc
+}
+
+func newProbesCollector() *probesCollector {
+	return &probesCollector{
+		started: prometheus.NewDesc("started", "startup phase of an app. 1 if complete, 0 otherwise", []string{"app"}, nil),
+		live:    prometheus.NewDesc("live", "liveness of an app. 1 if live, 0 otherwise", []string{"app"}, nil),
+	}
+}
+
+func (c *probesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.started
+	ch <- c.live
+}
+
+func (c *probesCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, app := range readinessRegistry.list() {
+		ch <- prometheus.MustNewConstMetric(c.started, prometheus.GaugeValue, boolToFloat(app.IsStarted()), app.service)
+		ch <- prometheus.MustNewConstMetric(c.live, prometheus.GaugeValue, boolToFloat(app.IsLive()), app.service)
+	}
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+func init() {
+	PrometheusRegister(newProbesCollector())
+}
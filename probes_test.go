@@ -0,0 +1,92 @@
+package dmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppReadiness_Probes(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("probes")
+	app.SetHeartbeatTimeout(20 * time.Millisecond)
+
+	assert.False(t, app.IsStarted())
+	assert.True(t, app.IsLive(), "liveness is not enforced during startup")
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, app.IsLive(), "liveness is not enforced during startup")
+
+	app.MarkStarted()
+	assert.True(t, app.IsStarted())
+	assert.True(t, app.IsLive(), "heartbeat timeout counts from the end of startup")
+
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, app.IsLive())
+
+	app.Heartbeat()
+	assert.True(t, app.IsLive())
+
+	app.SetHeartbeatTimeout(0)
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, app.IsLive(), "heartbeat tracking disabled")
+}
+
+func TestProbes_Rollup(t *testing.T) {
+	useTestReadinessRegistry(t)
+	assert.True(t, IsStarted())
+	assert.True(t, IsLive())
+
+	first := NewSet().NewAppReadiness("probes_rollup_a")
+	second := NewSet().NewAppReadiness("probes_rollup_b")
+	second.SetHeartbeatTimeout(time.Nanosecond)
+
+	first.MarkStarted()
+	assert.False(t, IsStarted())
+
+	second.MarkStarted()
+	assert.True(t, IsStarted())
+
+	time.Sleep(time.Millisecond)
+	assert.False(t, IsLive())
+
+	expected := `
+		# HELP live liveness of an app. 1 if live, 0 otherwise
+		# TYPE live gauge
+		live{app="probes_rollup_a"} 1
+		live{app="probes_rollup_b"} 0
+		# HELP started startup phase of an app. 1 if complete, 0 otherwise
+		# TYPE started gauge
+		started{app="probes_rollup_a"} 1
+		started{app="probes_rollup_b"} 1
+	`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newProbesCollector())
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+
+	for _, test := range []struct {
+		handler http.Handler
+		status  int
+	}{
+		{StartupHandler(), http.StatusOK},
+		{LivenessHandler(), http.StatusServiceUnavailable},
+		{ReadinessHandler(), http.StatusServiceUnavailable},
+	} {
+		recorder := httptest.NewRecorder()
+		test.handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, test.status, recorder.Code)
+	}
+
+	second.SetHeartbeatTimeout(0)
+	recorder := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"live":true`)
+}
@@ -33,6 +33,7 @@ var NoOpPrometheusRegister = func(c ...prometheus.Collector) {}
 type Set struct {
 	autoRegister  bool
 	metricsPrefix string
+	clock         Clock
 
 	metrics      []Metric
 	isRegistered bool
@@ -57,10 +58,19 @@ func PrefixNameWith(prefix string) Option {
 	}
 }
 
+// UseClock configures the clock used by the time-based metrics of the set, like
+// [Histogram.ObserveSince] and [HeadTimeDrift], defaults to [RealClock]. Mainly
+// useful in tests with a [FakeClock].
+func UseClock(clock Clock) Option {
+	return func(s *Set) {
+		s.clock = clock
+	}
+}
+
 // NewSet creates a set of metrics that can then be used to create
 // a varieties of specific metrics (Gauge, Counter, Histogram).
 func NewSet(options ...Option) *Set {
-	s := &Set{}
+	s := &Set{clock: RealClock}
 	for _, option := range options {
 		option(s)
 	}
@@ -68,6 +78,16 @@ func NewSet(options ...Option) *Set {
 	return s
 }
 
+// getClock returns the clock of the set, [RealClock] when none is configured like for
+// a zero value Set.
+func (s *Set) getClock() Clock {
+	if s.clock == nil {
+		return RealClock
+	}
+
+	return s.clock
+}
+
 func (s *Set) add(metric Metric) Metric {
 	s.metrics = append(s.metrics, metric)
 
@@ -83,12 +103,43 @@ func (s *Set) Register() {
 	}
 
 	for _, metric := range s.metrics {
+		if tracker, ok := metric.(*HeadTracker); ok {
+			// Its metrics may clash with the lazily registered legacy head metrics
+			tracker.register()
+			continue
+		}
+
 		PrometheusRegister(metric)
 	}
 
 	s.isRegistered = true
 }
 
+// NewRegistry creates a standalone Prometheus registry holding the metrics of the
+// given sets. This is useful to expose or push the metrics of some sets only, without
+// the ones found in the default registry (e.g. `go_*` and `process_*` metrics).
+func NewRegistry(sets ...*Set) (*prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	for _, set := range sets {
+		for _, metric := range set.metrics {
+			if err := registry.Register(metric); err != nil {
+				return nil, fmt.Errorf("register metric: %w", err)
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+// MustNewRegistry acts like [NewRegistry] but panics if an error occurs.
+func MustNewRegistry(sets ...*Set) *prometheus.Registry {
+	registry, err := NewRegistry(sets...)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
 type Metric interface {
 	prometheus.Collector
 }
@@ -221,7 +272,8 @@ func (s *Set) NewGaugeVec(name string, labels []string, helpChunks ...string) *G
 }
 
 type Histogram struct {
-	p prometheus.Histogram
+	p     prometheus.Histogram
+	clock Clock
 }
 
 func (s *Set) NewHistogram(name string, helpChunks ...string) *Histogram {
@@ -229,7 +281,8 @@ func (s *Set) NewHistogram(name string, helpChunks ...string) *Histogram {
 	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: name, Help: generateMetricsHelp(name, helpChunks)})
 
 	return s.add(&Histogram{
-		p: h,
+		p:     h,
+		clock: s.getClock(),
 	}).(*Histogram)
 }
 
@@ -238,7 +291,7 @@ func (h *Histogram) ObserveDuration(value time.Duration) {
 }
 
 func (h *Histogram) ObserveSince(value time.Time) {
-	h.p.Observe(time.Since(value).Seconds())
+	h.p.Observe(h.clock.Since(value).Seconds())
 }
 
 func (h *Histogram) ObserveInt(value int64) {
@@ -262,7 +315,8 @@ func (h *Histogram) Describe(in chan<- *prometheus.Desc) { h.p.Describe(in) }
 func (h *Histogram) Collect(in chan<- prometheus.Metric) { h.p.Collect(in) }
 
 type HistogramVec struct {
-	p *prometheus.HistogramVec
+	p     *prometheus.HistogramVec
+	clock Clock
 }
 
 func (s *Set) NewHistogramVec(name string, labels []string, helpChunks ...string) *HistogramVec {
@@ -270,7 +324,8 @@ func (s *Set) NewHistogramVec(name string, labels []string, helpChunks ...string
 	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: generateMetricsHelp(name, helpChunks)}, labels)
 
 	return s.add(&HistogramVec{
-		p: h,
+		p:     h,
+		clock: s.getClock(),
 	}).(*HistogramVec)
 }
 
@@ -279,7 +334,7 @@ func (h *HistogramVec) ObserveDuration(value time.Duration, labels ...string) {
 }
 
 func (h *HistogramVec) ObserveSince(value time.Time, labels ...string) {
-	h.p.WithLabelValues(labels...).Observe(time.Since(value).Seconds())
+	h.p.WithLabelValues(labels...).Observe(h.clock.Since(value).Seconds())
 }
 
 func (h *HistogramVec) ObserveInt(value int64, labels ...string) {
@@ -0,0 +1,185 @@
+package dmetrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"go.uber.org/zap"
+)
+
+// Pusher periodically pushes the metrics of a Prometheus gatherer to a Pushgateway,
+// useful for batch jobs that terminate before a scrape ever happen. A final push is
+// always performed when the Pusher is closed so the last values are never lost.
+//
+// ```
+// pusher := dmetrics.NewPusher("http://pushgateway:9091", "reprocessing", dmetrics.MustNewRegistry(bstream.MetricsSet))
+// pusher.Start(ctx)
+// defer pusher.Close()
+// ```
+type Pusher struct {
+	pusher   *push.Pusher
+	url      string
+	interval time.Duration
+
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+	closeErr  error
+}
+
+type PusherOption func(p *Pusher)
+
+const defaultPushInterval = 15 * time.Second
+
+// PushInterval configures at which interval the metrics are pushed, defaults to 15s.
+// A zero or negative interval keeps the default.
+func PushInterval(interval time.Duration) PusherOption {
+	return func(p *Pusher) {
+		p.interval = interval
+	}
+}
+
+// PushGrouping adds a grouping key label to the pushed metrics, can be used multiple
+// times to define multiple grouping key labels.
+func PushGrouping(name, value string) PusherOption {
+	return func(p *Pusher) {
+		p.pusher.Grouping(name, value)
+	}
+}
+
+// PushRetry configures how a failing push is retried, the backoff between attempts is
+// doubled after each failure starting at <initialBackoff> and capped at <maxBackoff>.
+// Defaults to 5 attempts with a backoff starting at 500ms and capped at 10s.
+func PushRetry(maxAttempts int, initialBackoff time.Duration, maxBackoff time.Duration) PusherOption {
+	return func(p *Pusher) {
+		p.maxAttempts = maxAttempts
+		p.initialBackoff = initialBackoff
+		p.maxBackoff = maxBackoff
+	}
+}
+
+// PushHTTPClient configures the HTTP client used to talk to the Pushgateway.
+func PushHTTPClient(client *http.Client) PusherOption {
+	return func(p *Pusher) {
+		p.pusher.Client(client)
+	}
+}
+
+// NewPusher creates a [Pusher] for the given gatherer, use [NewRegistry] to push
+// the metrics of one or more [Set]. The <job> is used as the `job` grouping key and
+// must not be empty.
+func NewPusher(gatewayURL string, job string, gatherer prometheus.Gatherer, options ...PusherOption) *Pusher {
+	p := &Pusher{
+		pusher:         push.New(gatewayURL, job).Gatherer(gatherer),
+		url:            gatewayURL,
+		interval:       defaultPushInterval,
+		maxAttempts:    5,
+		initialBackoff: 500 * time.Millisecond,
+		maxBackoff:     10 * time.Second,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	if p.interval <= 0 {
+		p.interval = defaultPushInterval
+	}
+
+	if p.maxAttempts <= 0 {
+		p.maxAttempts = 1
+	}
+
+	return p
+}
+
+// Start launches the background goroutine pushing the metrics at the configured
+// interval. Pushing stops when the context is canceled or when [Pusher.Close] is
+// called, whichever comes first.
+func (p *Pusher) Start(ctx context.Context) {
+	p.startOnce.Do(func() {
+		go p.run(ctx)
+	})
+}
+
+func (p *Pusher) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.push(p.stop); err != nil {
+				zlog.Warn("unable to push metrics to pushgateway", zap.String("url", p.url), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Push pushes the metrics right now, retrying with backoff on failure.
+func (p *Pusher) Push() error {
+	return p.push(nil)
+}
+
+// Close stops the periodic pushes and performs a final push, the error of the final
+// push, if any, is returned. Calling it multiple times is safe, the final push is
+// performed only once.
+func (p *Pusher) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+
+		// Ensures no more pushing can be started by the background goroutine
+		p.startOnce.Do(func() { close(p.done) })
+		<-p.done
+
+		p.closeErr = p.push(nil)
+	})
+
+	return p.closeErr
+}
+
+// push pushes the metrics retrying up to the maximum amount of attempts. The retry
+// loop is aborted as soon as <abort> is closed, a nil <abort> never aborts.
+func (p *Pusher) push(abort <-chan struct{}) (err error) {
+	backoff := p.initialBackoff
+	for attempt := 1; ; attempt++ {
+		if err = p.pusher.Push(); err == nil {
+			return nil
+		}
+
+		if attempt >= p.maxAttempts {
+			return fmt.Errorf("push failed after %d attempt(s): %w", attempt, err)
+		}
+
+		zlog.Debug("push to pushgateway failed, retrying", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+
+		select {
+		case <-time.After(backoff):
+		case <-abort:
+			return fmt.Errorf("push aborted after %d attempt(s): %w", attempt, err)
+		}
+
+		backoff *= 2
+		if backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package dmetrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPushgateway struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	failures int
+	pushes   []testPush
+}
+
+type testPush struct {
+	method string
+	path   string
+	body   string
+}
+
+func newTestPushgateway(failures int) *testPushgateway {
+	g := &testPushgateway{failures: failures}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+
+		if g.failures > 0 {
+			g.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		// The Pushgateway receives protobuf, convert it to text so it's easier to assert on
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		body := &strings.Builder{}
+		for {
+			family := new(dto.MetricFamily)
+			err := decoder.Decode(family)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			expfmt.MetricFamilyToText(body, family)
+		}
+
+		g.pushes = append(g.pushes, testPush{r.Method, r.URL.Path, body.String()})
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return g
+}
+
+func (g *testPushgateway) received() []testPush {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return append([]testPush(nil), g.pushes...)
+}
+
+func TestPusher_PushOnClose(t *testing.T) {
+	gateway := newTestPushgateway(0)
+	defer gateway.Close()
+
+	set := NewSet()
+	counter := set.NewCounter("push_on_close")
+
+	pusher := NewPusher(gateway.URL, "batch", MustNewRegistry(set), PushGrouping("instance", "a"))
+	counter.AddInt(3)
+
+	require.NoError(t, pusher.Close())
+	require.NoError(t, pusher.Close())
+
+	pushes := gateway.received()
+	require.Len(t, pushes, 1)
+	assert.Equal(t, http.MethodPut, pushes[0].method)
+	assert.Equal(t, "/metrics/job/batch/instance/a", pushes[0].path)
+	assert.Contains(t, pushes[0].body, "push_on_close 3")
+}
+
+func TestPusher_Interval(t *testing.T) {
+	gateway := newTestPushgateway(0)
+	defer gateway.Close()
+
+	set := NewSet()
+	set.NewGauge("push_interval")
+
+	pusher := NewPusher(gateway.URL, "batch", MustNewRegistry(set), PushInterval(10*time.Millisecond))
+	pusher.Start(context.Background())
+
+	require.Eventually(t, func() bool { return len(gateway.received()) >= 2 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, pusher.Close())
+
+	pushCount := len(gateway.received())
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, pushCount, len(gateway.received()), "no push should happen after close")
+}
+
+func TestPusher_InvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		pusher := NewPusher("http://localhost:9091", "batch", MustNewRegistry(), PushInterval(interval))
+		assert.Equal(t, defaultPushInterval, pusher.interval)
+	}
+}
+
+func TestPusher_Retry(t *testing.T) {
+	gateway := newTestPushgateway(2)
+	defer gateway.Close()
+
+	set := NewSet()
+	set.NewGauge("push_retry")
+
+	pusher := NewPusher(gateway.URL, "batch", MustNewRegistry(set), PushRetry(3, time.Millisecond, time.Millisecond))
+	require.NoError(t, pusher.Push())
+	assert.Len(t, gateway.received(), 1)
+
+	gateway.lock.Lock()
+	gateway.failures = 3
+	gateway.lock.Unlock()
+
+	assert.Error(t, pusher.Push())
+}
@@ -6,13 +6,18 @@ import (
 	"time"
 
 	"github.com/paulbellamy/ratecounter"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
 )
 
+// RateCounter is safe for concurrent use.
 type RateCounter struct {
+	*scrapeGauges
+
 	counter  *ratecounter.RateCounter
 	interval time.Duration
 	unit     string
-	total    uint64
+	total    *atomic.Uint64
 }
 
 // NewRateCounter allows you to know  how many times an event happen over a fixed period of time
@@ -38,7 +43,7 @@ func NewRateCounter(interval time.Duration, unit string) *RateCounter {
 		counter:  ratecounter.NewRateCounter(interval),
 		interval: interval,
 		unit:     unit,
-		total:    0,
+		total:    atomic.NewUint64(0),
 	}
 }
 
@@ -53,7 +58,7 @@ func NewPerMinuteLocalRateCounter(unit string) *RateCounter {
 // Incr add 1 event into the RateCounter
 func (c *RateCounter) Inc() {
 	c.counter.Incr(1)
-	c.total++
+	c.total.Inc()
 }
 
 // IncrBy adds multiple events inot the RateCounter
@@ -63,11 +68,11 @@ func (c *RateCounter) IncBy(value int64) {
 	}
 
 	c.counter.Incr(value)
-	c.total += uint64(value)
+	c.total.Add(uint64(value))
 }
 
 func (c *RateCounter) Total() uint64 {
-	return c.total
+	return c.total.Load()
 }
 
 func (c *RateCounter) Rate() int64 {
@@ -82,5 +87,18 @@ func (c *RateCounter) RateString() string {
 //var elapsedPerElementUnitPrefixRegex = regexp.MustCompile("^(h|min|s|ms)/")
 
 func (c *RateCounter) String() string {
-	return fmt.Sprintf("%s %s/%s (%d total)", c.RateString(), c.unit, timeUnitToString(c.interval), c.total)
+	return fmt.Sprintf("%s %s/%s (%d total)", c.RateString(), c.unit, timeUnitToString(c.interval), c.Total())
+}
+
+// MarshalLogObject logs the `rate`, `total`, `unit` and `window_seconds` fields.
+func (c *RateCounter) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt64("rate", c.Rate())
+	enc.AddUint64("total", c.Total())
+	enc.AddString("unit", c.unit)
+	enc.AddFloat64("window_seconds", c.interval.Seconds())
+	return nil
+}
+
+func (c *RateCounter) MarshalJSON() ([]byte, error) {
+	return marshalObjectJSON(c)
 }
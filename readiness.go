@@ -15,6 +15,12 @@
 package dmetrics
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -24,26 +30,506 @@ var appReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 },
 	[]string{"app"})
 
+var appReadySince = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "ready_since_seconds",
+	Help: "unix timestamp in seconds at which the app last became ready, 0 if not ready",
+},
+	[]string{"app"})
+
+var appReadyTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "ready_transitions_total",
+	Help: "number of times the readiness of an app flipped, by the state it flipped to",
+},
+	[]string{"app", "to"})
+
+// readinessHistorySize is the maximum number of transitions kept in the history of an app
+const readinessHistorySize = 32
+
+var readinessRegistry = &readinessApps{apps: map[string]*AppReadiness{}}
+
+// State is the readiness state of an app or of one of its components. `Since` is the
+// time at which `Ready` last changed value.
+type State struct {
+	Ready  bool      `json:"ready"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+func (s State) String() string {
+	if s.Ready {
+		return "ready"
+	}
+
+	if s.Reason == "" {
+		return "not ready"
+	}
+
+	return "not ready (" + s.Reason + ")"
+}
+
+// AppReadiness tracks the readiness of an app. An app is ready when it has been
+// flagged ready itself and when all its components are ready. Components are
+// created on demand through [AppReadiness.Component] and are useful to track the
+// state of multiple sub-systems (e.g. a database connection, a block source, a gRPC
+// server) each flipping readiness independently.
+//
+// All apps are tracked in a process wide registry, see [IsReady] and [Readiness].
+//
+// Code can react to readiness flips through [AppReadiness.OnChange] and
+// [AppReadiness.Watch], the last transitions are kept in memory and available
+// through [AppReadiness.History].
 type AppReadiness struct {
 	service string
+
+	lock           sync.RWMutex
+	self           State
+	components     map[string]*ReadinessComponent
+	componentNames []string
+	state          State
+	history        []State
+
+	listeners      map[uint64]func(old, new State)
+	nextListenerID uint64
+	pending        []readinessChange
+	dispatching    bool
+
+	checksLock sync.Mutex
+	checks     map[string]*readinessCheck
+
+	probes appProbes
+}
+
+type readinessChange struct {
+	old State
+	new State
 }
 
+// NewAppReadiness returns the readiness tracker of the given app, it starts as not
+// ready. Calling it multiple times with the same service name returns the same
+// instance.
 func (s *Set) NewAppReadiness(service string) *AppReadiness {
-	a := &AppReadiness{
-		service: service,
-	}
-	a.SetNotReady()
-	return a
+	return readinessRegistry.getOrCreate(service, func() *AppReadiness {
+		a := &AppReadiness{
+			service:    service,
+			components: map[string]*ReadinessComponent{},
+			listeners:  map[uint64]func(old, new State){},
+			checks:     map[string]*readinessCheck{},
+			probes:     newAppProbes(),
+		}
+		a.SetNotReady("initializing")
+		return a
+	})
 }
 
+// SetReady flags the app itself as ready, the app is reported ready only if all
+// its components are ready too.
 func (a *AppReadiness) SetReady() {
-	appReady.WithLabelValues(a.service).Set(1)
+	a.lock.Lock()
+	a.self = transition(a.self, true, "")
+	a.refresh()
+	a.lock.Unlock()
+
+	a.dispatch()
+}
+
+// SetNotReady flags the app as not ready for the given reason.
+func (a *AppReadiness) SetNotReady(reason string) {
+	a.lock.Lock()
+	a.self = transition(a.self, false, reason)
+	a.refresh()
+	a.lock.Unlock()
+
+	a.dispatch()
+}
+
+// IsReady returns true if the app and all its components are ready.
+func (a *AppReadiness) IsReady() bool {
+	return a.State().Ready
 }
 
-func (a *AppReadiness) SetNotReady() {
-	appReady.WithLabelValues(a.service).Set(0)
+// State returns the aggregated state of the app, when not ready the reason is the
+// app's own reason or the reason of the first component not ready.
+func (a *AppReadiness) State() State {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	return a.state
+}
+
+// Component returns the readiness tracker of the given component of this app,
+// creating it if it does not exist yet. A newly created component starts as not
+// ready.
+func (a *AppReadiness) Component(name string) *ReadinessComponent {
+	component, _ := a.component(name)
+	return component
+}
+
+// component acts like [AppReadiness.Component], also returning whether the component
+// was created by this call.
+func (a *AppReadiness) component(name string) (*ReadinessComponent, bool) {
+	a.lock.Lock()
+	if component, found := a.components[name]; found {
+		a.lock.Unlock()
+		return component, false
+	}
+
+	component := &ReadinessComponent{app: a, name: name, state: transition(State{}, false, "initializing")}
+	a.components[name] = component
+	a.componentNames = append(a.componentNames, name)
+	a.refresh()
+	a.lock.Unlock()
+
+	a.dispatch()
+	return component, true
+}
+
+// removeComponent removes the component from the app, it no longer affects the
+// readiness of the app. Nothing is removed if another component replaced it.
+func (a *AppReadiness) removeComponent(component *ReadinessComponent) {
+	name := component.name
+
+	a.lock.Lock()
+	if a.components[name] != component {
+		a.lock.Unlock()
+		return
+	}
+
+	delete(a.components, name)
+	for i, componentName := range a.componentNames {
+		if componentName == name {
+			a.componentNames = append(a.componentNames[:i], a.componentNames[i+1:]...)
+			break
+		}
+	}
+	a.refresh()
+	a.lock.Unlock()
+
+	a.dispatch()
+}
+
+// OnChange registers a callback invoked each time the readiness of the app flips,
+// with the state before and after the flip. Callbacks are invoked sequentially, in
+// the order the flips happened, and outside of any lock so they are free to query
+// or modify the readiness. The returned function unregisters the callback.
+func (a *AppReadiness) OnChange(callback func(old, new State)) (unregister func()) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.addListener(callback)
+}
+
+// addListener registers the listener, the lock must be held
+func (a *AppReadiness) addListener(callback func(old, new State)) (unregister func()) {
+	id := a.nextListenerID
+	a.nextListenerID++
+	a.listeners[id] = callback
+
+	return func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		delete(a.listeners, id)
+	}
+}
+
+// Watch returns a channel receiving the current state of the app right away and then
+// the new state each time the readiness flips. The channel only ever holds the most
+// recent state, a slow reader skips intermediate states. The channel is closed when
+// the context is done.
+func (a *AppReadiness) Watch(ctx context.Context) <-chan State {
+	states := make(chan State, 1)
+
+	var lock sync.Mutex
+	closed := false
+	publish := func(state State) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if closed {
+			return
+		}
+
+		// Replace the unread state, if any, with the most recent one
+		select {
+		case <-states:
+		default:
+		}
+		states <- state
+	}
+
+	// Under the same lock so no change can happen between the initial state and
+	// the registration of the listener
+	a.lock.Lock()
+	publish(a.state)
+	unregister := a.addListener(func(_, new State) { publish(new) })
+	a.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		unregister()
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		closed = true
+		close(states)
+	}()
+
+	return states
+}
+
+// History returns the last readiness flips of the app, oldest first. Each entry is
+// the state the app flipped to, its `Since` being the time of the flip.
+func (a *AppReadiness) History() []State {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	return append([]State(nil), a.history...)
+}
+
+// Report returns a snapshot of the state of the app and of its components.
+func (a *AppReadiness) Report() AppReadinessReport {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	report := AppReadinessReport{
+		App:     a.service,
+		State:   a.state,
+		Started: a.IsStarted(),
+		Live:    a.IsLive(),
+		History: append([]State(nil), a.history...),
+	}
+	for _, name := range a.componentNames {
+		report.Components = append(report.Components, ComponentReadinessReport{Name: name, State: a.components[name].state})
+	}
+
+	return report
+}
+
+// refresh recomputes the aggregated state and updates the metrics, it must be called
+// with the write lock held.
+func (a *AppReadiness) refresh() {
+	ready, reason := a.self.Ready, a.self.Reason
+	if ready {
+		for _, name := range a.componentNames {
+			if component := a.components[name]; !component.state.Ready {
+				ready, reason = false, fmt.Sprintf("%s: %s", name, component.state.Reason)
+				break
+			}
+		}
+	}
+
+	previous := a.state
+	a.state = transition(a.state, ready, reason)
+	a.updateMetrics()
+
+	// The very first state of the app is not a transition
+	if previous.Since.IsZero() || previous.Ready == a.state.Ready {
+		return
+	}
+
+	a.history = append(a.history, a.state)
+	if len(a.history) > readinessHistorySize {
+		a.history = a.history[len(a.history)-readinessHistorySize:]
+	}
+
+	appReadyTransitions.WithLabelValues(a.service, readyLabel(a.state.Ready)).Inc()
+	a.pending = append(a.pending, readinessChange{previous, a.state})
+}
+
+// dispatch invokes the listeners for every pending change, it must be called
+// without holding the lock. Only one goroutine dispatches at a time, which keeps
+// the changes ordered even if a listener modifies the readiness itself.
+func (a *AppReadiness) dispatch() {
+	a.lock.Lock()
+	if a.dispatching {
+		a.lock.Unlock()
+		return
+	}
+
+	a.dispatching = true
+	for len(a.pending) > 0 {
+		change := a.pending[0]
+		a.pending = a.pending[1:]
+
+		listeners := make([]func(old, new State), 0, len(a.listeners))
+		for _, listener := range a.listeners {
+			listeners = append(listeners, listener)
+		}
+		a.lock.Unlock()
+
+		for _, listener := range listeners {
+			listener(change.old, change.new)
+		}
+
+		a.lock.Lock()
+	}
+	a.dispatching = false
+	a.lock.Unlock()
+}
+
+func (a *AppReadiness) updateMetrics() {
+	if a.state.Ready {
+		appReady.WithLabelValues(a.service).Set(1)
+		appReadySince.WithLabelValues(a.service).Set(float64(a.state.Since.UnixNano()) / float64(time.Second))
+	} else {
+		appReady.WithLabelValues(a.service).Set(0)
+		appReadySince.WithLabelValues(a.service).Set(0)
+	}
+}
+
+// ReadinessComponent tracks the readiness of one component of an app, see
+// [AppReadiness.Component].
+type ReadinessComponent struct {
+	app   *AppReadiness
+	name  string
+	state State
+}
+
+func (c *ReadinessComponent) SetReady() {
+	c.app.lock.Lock()
+	c.state = transition(c.state, true, "")
+	c.app.refresh()
+	c.app.lock.Unlock()
+
+	c.app.dispatch()
+}
+
+func (c *ReadinessComponent) SetNotReady(reason string) {
+	c.app.lock.Lock()
+	c.state = transition(c.state, false, reason)
+	c.app.refresh()
+	c.app.lock.Unlock()
+
+	c.app.dispatch()
+}
+
+func (c *ReadinessComponent) IsReady() bool {
+	c.app.lock.RLock()
+	defer c.app.lock.RUnlock()
+
+	return c.state.Ready
+}
+
+// transition returns the new state, keeping the `Since` time of the previous state
+// when readiness did not change.
+func transition(previous State, ready bool, reason string) State {
+	next := State{Ready: ready, Reason: reason, Since: previous.Since}
+	if previous.Since.IsZero() || previous.Ready != ready {
+		next.Since = time.Now()
+	}
+
+	return next
+}
+
+// ReadinessReport is the structured view of the readiness of the process, it is
+// ready when all its apps are ready. It also holds the startup and liveness of the
+// process, which follow the same rule.
+type ReadinessReport struct {
+	Ready   bool                 `json:"ready"`
+	Started bool                 `json:"started"`
+	Live    bool                 `json:"live"`
+	Apps    []AppReadinessReport `json:"apps"`
+}
+
+type AppReadinessReport struct {
+	App string `json:"app"`
+	State
+	Started    bool                       `json:"started"`
+	Live       bool                       `json:"live"`
+	Components []ComponentReadinessReport `json:"components,omitempty"`
+	History    []State                    `json:"history,omitempty"`
+}
+
+type ComponentReadinessReport struct {
+	Name string `json:"name"`
+	State
+}
+
+// IsReady returns true if all the apps of the process are ready, a process without
+// any app is considered ready.
+func IsReady() bool {
+	for _, app := range readinessRegistry.list() {
+		if !app.IsReady() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Readiness returns the structured view of the readiness, startup and liveness of
+// every app of the process.
+func Readiness() ReadinessReport {
+	report := ReadinessReport{Ready: true, Started: true, Live: true, Apps: []AppReadinessReport{}}
+	for _, app := range readinessRegistry.list() {
+		appReport := app.Report()
+		report.Ready = report.Ready && appReport.Ready
+		report.Started = report.Started && appReport.Started
+		report.Live = report.Live && appReport.Live
+
+		report.Apps = append(report.Apps, appReport)
+	}
+
+	return report
+}
+
+// LookupAppReadiness returns the readiness tracker of the given app, if it was
+// created through [Set.NewAppReadiness].
+func LookupAppReadiness(service string) (*AppReadiness, bool) {
+	return readinessRegistry.get(service)
+}
+
+type readinessApps struct {
+	lock sync.Mutex
+	apps map[string]*AppReadiness
+}
+
+func (r *readinessApps) getOrCreate(service string, create func() *AppReadiness) *AppReadiness {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if app, found := r.apps[service]; found {
+		return app
+	}
+
+	app := create()
+	r.apps[service] = app
+	return app
+}
+
+func (r *readinessApps) get(service string) (*AppReadiness, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	app, found := r.apps[service]
+	return app, found
+}
+
+// list returns the apps sorted by service name
+func (r *readinessApps) list() []*AppReadiness {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	apps := make([]*AppReadiness, 0, len(r.apps))
+	for _, app := range r.apps {
+		apps = append(apps, app)
+	}
+
+	sort.Slice(apps, func(i, j int) bool { return apps[i].service < apps[j].service })
+	return apps
+}
+
+func readyLabel(ready bool) string {
+	if ready {
+		return "ready"
+	}
+
+	return "not_ready"
 }
 
 func init() {
 	PrometheusRegister(appReady)
+	PrometheusRegister(appReadySince)
+	PrometheusRegister(appReadyTransitions)
 }
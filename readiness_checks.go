@@ -0,0 +1,273 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dmetrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var readinessCheckDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "readiness_check_duration_seconds",
+	Help: "duration in seconds of the last run of a readiness check",
+},
+	[]string{"app", "check"})
+
+var readinessCheckConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "readiness_check_consecutive_failures",
+	Help: "number of consecutive failed runs of a readiness check, 0 when the last run passed",
+},
+	[]string{"app", "check"})
+
+var readinessCheckLastError = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "readiness_check_last_error_timestamp_seconds",
+	Help: "unix timestamp in seconds of the last failed run of a readiness check, 0 if it never failed",
+},
+	[]string{"app", "check"})
+
+// CheckFunc is a readiness check, it returns an error describing why the check is not
+// passing. The context is canceled when the check times out.
+type CheckFunc func(ctx context.Context) error
+
+type CheckOption func(c *readinessCheck)
+
+// PassingThreshold configures how many consecutive runs must pass before the check
+// is considered ready, defaults to 1. A single failure always flags the check as not
+// ready.
+func PassingThreshold(runs int) CheckOption {
+	return func(c *readinessCheck) {
+		if runs > 0 {
+			c.passingThreshold = runs
+		}
+	}
+}
+
+type readinessCheck struct {
+	app              *AppReadiness
+	name             string
+	check            CheckFunc
+	interval         time.Duration
+	timeout          time.Duration
+	passingThreshold int
+	component        *ReadinessComponent
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// AddCheck registers a check run in the background right away and then at every
+// interval, each run being canceled after the timeout. The check drives the
+// component of the same name, see [AppReadiness.Component], making the app not ready
+// as soon as a run fails, the error being the reason, and ready again once enough
+// consecutive runs passed (see [PassingThreshold]). Adding a check with the name of
+// an existing check replaces it. The interval and the timeout must be positive.
+//
+// ```
+// readiness.AddCheck("node", dmetrics.TCPDialCheck("localhost:8545"), 5*time.Second, time.Second)
+// readiness.AddCheck("head", dmetrics.HeadDriftCheck(headTimeDrift, 30*time.Second), 5*time.Second, time.Second, dmetrics.PassingThreshold(3))
+// ```
+func (a *AppReadiness) AddCheck(name string, check CheckFunc, interval, timeout time.Duration, options ...CheckOption) error {
+	if interval <= 0 {
+		return fmt.Errorf("check %q interval must be greater than 0, got %s", name, interval)
+	}
+
+	if timeout <= 0 {
+		return fmt.Errorf("check %q timeout must be greater than 0, got %s", name, timeout)
+	}
+
+	c := &readinessCheck{
+		app:              a,
+		name:             name,
+		check:            check,
+		interval:         interval,
+		timeout:          timeout,
+		passingThreshold: 1,
+		done:             make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	// Outside of the checks lock, creating the component notifies the listeners which
+	// could add checks themselves
+	c.component = a.Component(name)
+
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+
+	a.checksLock.Lock()
+	defer a.checksLock.Unlock()
+
+	previous := a.checks[name]
+	if previous != nil {
+		previous.cancel()
+	}
+
+	a.checks[name] = c
+	go c.run(ctx, previous)
+
+	return nil
+}
+
+// RemoveCheck stops the check and removes its component, it no longer affects the
+// readiness of the app.
+func (a *AppReadiness) RemoveCheck(name string) {
+	a.checksLock.Lock()
+	c, found := a.checks[name]
+	if !found {
+		a.checksLock.Unlock()
+		return
+	}
+
+	c.cancel()
+	delete(a.checks, name)
+	a.checksLock.Unlock()
+
+	// Waited outside of the lock, a run notifies the listeners which could add checks
+	<-c.done
+
+	a.removeComponent(c.component)
+	readinessCheckDuration.DeleteLabelValues(a.service, name)
+	readinessCheckConsecutiveFailures.DeleteLabelValues(a.service, name)
+	readinessCheckLastError.DeleteLabelValues(a.service, name)
+}
+
+// StopChecks stops all the checks of the app, their components keep the state of
+// their last run. Useful on shutdown, usually right after flagging the app not ready.
+func (a *AppReadiness) StopChecks() {
+	a.checksLock.Lock()
+	stopped := make([]*readinessCheck, 0, len(a.checks))
+	for name, c := range a.checks {
+		c.cancel()
+		stopped = append(stopped, c)
+		delete(a.checks, name)
+	}
+	a.checksLock.Unlock()
+
+	// Waited outside of the lock, a run notifies the listeners which could add checks
+	for _, c := range stopped {
+		<-c.done
+	}
+}
+
+// run runs the check until the context is canceled, the check it replaces, if any,
+// being terminated first so their outcomes never interleave.
+func (c *readinessCheck) run(ctx context.Context, previous *readinessCheck) {
+	defer close(c.done)
+
+	if previous != nil {
+		select {
+		case <-previous.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	passes, failures := 0, 0
+	for {
+		c.runOnce(ctx, &passes, &failures)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *readinessCheck) runOnce(ctx context.Context, passes, failures *int) {
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(checkCtx)
+	duration := time.Since(start)
+
+	if ctx.Err() != nil {
+		// The check was stopped while running, its outcome is meaningless
+		return
+	}
+
+	if err == nil && checkCtx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+
+	readinessCheckDuration.WithLabelValues(c.app.service, c.name).Set(duration.Seconds())
+
+	if err != nil {
+		*passes = 0
+		*failures++
+
+		readinessCheckConsecutiveFailures.WithLabelValues(c.app.service, c.name).Set(float64(*failures))
+		readinessCheckLastError.WithLabelValues(c.app.service, c.name).Set(float64(time.Now().UnixNano()) / float64(time.Second))
+		c.component.SetNotReady(err.Error())
+		return
+	}
+
+	*passes++
+	*failures = 0
+
+	readinessCheckConsecutiveFailures.WithLabelValues(c.app.service, c.name).Set(0)
+	if *passes >= c.passingThreshold {
+		c.component.SetReady()
+	} else if !c.component.IsReady() {
+		c.component.SetNotReady(fmt.Sprintf("passed %d of %d required consecutive checks", *passes, c.passingThreshold))
+	}
+}
+
+// HeadDriftCheck returns a check passing when the head block time tracked by the
+// drift is at most `maxDrift` away from real-time. It fails until a first block time
+// is received.
+func HeadDriftCheck(drift *HeadTimeDrift, maxDrift time.Duration) CheckFunc {
+	return func(_ context.Context) error {
+		if drift.LastBlockTime().IsZero() {
+			return fmt.Errorf("no head block received yet")
+		}
+
+		if current := drift.Drift(); current > maxDrift {
+			return fmt.Errorf("head block drift of %s exceeds %s", current.Truncate(time.Millisecond), maxDrift)
+		}
+
+		return nil
+	}
+}
+
+// TCPDialCheck returns a check passing when a TCP connection to the address can be
+// established.
+func TCPDialCheck(address string) CheckFunc {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	}
+}
+
+func init() {
+	PrometheusRegister(readinessCheckDuration)
+	PrometheusRegister(readinessCheckConsecutiveFailures)
+	PrometheusRegister(readinessCheckLastError)
+}
@@ -0,0 +1,151 @@
+package dmetrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestAppReadiness_AddCheck(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_checks")
+	app.SetReady()
+	defer app.StopChecks()
+
+	failing := atomic.NewBool(true)
+	runs := atomic.NewInt64(0)
+	require.NoError(t, app.AddCheck("database", func(ctx context.Context) error {
+		runs.Inc()
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, 5*time.Millisecond, time.Second, PassingThreshold(3)))
+
+	require.Eventually(t, func() bool { return app.State().Reason == "database: connection refused" }, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(readinessCheckConsecutiveFailures.WithLabelValues("readiness_checks", "database")) >= 2
+	}, time.Second, time.Millisecond)
+	assert.NotZero(t, testutil.ToFloat64(readinessCheckLastError.WithLabelValues("readiness_checks", "database")))
+
+	failing.Store(false)
+	recovering := runs.Load()
+	require.Eventually(t, app.IsReady, time.Second, time.Millisecond)
+	assert.GreaterOrEqual(t, runs.Load()-recovering, int64(3), "ready only after 3 consecutive passes")
+	assert.Equal(t, 0.0, testutil.ToFloat64(readinessCheckConsecutiveFailures.WithLabelValues("readiness_checks", "database")))
+
+	failing.Store(true)
+	require.Eventually(t, func() bool { return !app.IsReady() }, time.Second, time.Millisecond)
+
+	app.RemoveCheck("database")
+	assert.True(t, app.IsReady())
+	assert.Empty(t, app.Report().Components)
+
+	stopped := runs.Load()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load(), "no run should happen after removal")
+}
+
+func TestAppReadiness_AddCheckTimeout(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_checks_timeout")
+	app.SetReady()
+	defer app.StopChecks()
+
+	require.NoError(t, app.AddCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, time.Hour, 5*time.Millisecond))
+
+	require.Eventually(t, func() bool { return app.State().Reason == "slow: timed out after 5ms" }, time.Second, time.Millisecond)
+}
+
+func TestAppReadiness_AddCheckInvalid(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_checks_invalid")
+	pass := func(ctx context.Context) error { return nil }
+
+	assert.EqualError(t, app.AddCheck("zero", pass, 0, time.Second), `check "zero" interval must be greater than 0, got 0s`)
+	assert.EqualError(t, app.AddCheck("negative", pass, -time.Second, time.Second), `check "negative" interval must be greater than 0, got -1s`)
+	assert.EqualError(t, app.AddCheck("timeout", pass, time.Second, 0), `check "timeout" timeout must be greater than 0, got 0s`)
+	assert.Empty(t, app.Report().Components)
+}
+
+func TestAppReadiness_StopChecksDoesNotHoldLock(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_checks_stop")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	require.NoError(t, app.AddCheck("stuck", func(ctx context.Context) error {
+		close(started)
+		// Ignores its context
+		<-release
+		return nil
+	}, time.Hour, time.Hour))
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		app.StopChecks()
+		close(stopped)
+	}()
+
+	// Waiting for the stuck check does not prevent managing the other checks
+	added := make(chan error)
+	go func() {
+		added <- app.AddCheck("other", func(ctx context.Context) error { return nil }, time.Hour, time.Second)
+	}()
+
+	select {
+	case err := <-added:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("adding a check blocked while stopping the checks")
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("checks not stopped once the stuck check returned")
+	}
+
+	app.StopChecks()
+}
+
+func TestTCPDialCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	address := listener.Addr().String()
+	assert.NoError(t, TCPDialCheck(address)(context.Background()))
+
+	require.NoError(t, listener.Close())
+	assert.Error(t, TCPDialCheck(address)(context.Background()))
+}
+
+func TestHeadDriftCheck(t *testing.T) {
+	drift := NewSet().NewHeadTimeDrift("readiness_head_drift")
+	defer drift.Stop()
+	check := HeadDriftCheck(drift, time.Minute)
+
+	assert.EqualError(t, check(context.Background()), "no head block received yet")
+
+	drift.SetBlockTime(time.Now())
+	assert.NoError(t, check(context.Background()))
+
+	drift.SetBlockTime(time.Now().Add(-2 * time.Hour))
+	assert.Error(t, check(context.Background()))
+}
@@ -0,0 +1,244 @@
+package dmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppReadiness(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_plain")
+	assert.False(t, app.IsReady())
+	assert.Equal(t, "initializing", app.State().Reason)
+	assert.Equal(t, 0.0, testutil.ToFloat64(appReady.WithLabelValues("readiness_plain")))
+
+	app.SetReady()
+	assert.True(t, app.IsReady())
+	assert.Equal(t, 1.0, testutil.ToFloat64(appReady.WithLabelValues("readiness_plain")))
+	assert.Equal(t, float64(app.State().Since.UnixNano())/1e9, testutil.ToFloat64(appReadySince.WithLabelValues("readiness_plain")))
+
+	app.SetNotReady("shutting down")
+	assert.False(t, app.IsReady())
+	assert.Equal(t, "shutting down", app.State().Reason)
+	assert.Equal(t, 0.0, testutil.ToFloat64(appReady.WithLabelValues("readiness_plain")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(appReadySince.WithLabelValues("readiness_plain")))
+
+	assert.Same(t, app, NewSet().NewAppReadiness("readiness_plain"))
+}
+
+func TestAppReadiness_Components(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_components")
+	app.SetReady()
+
+	database := app.Component("database")
+	source := app.Component("source")
+	assert.Same(t, database, app.Component("database"))
+	assert.False(t, app.IsReady())
+	assert.Equal(t, "database: initializing", app.State().Reason)
+
+	database.SetReady()
+	source.SetNotReady("connection refused")
+	assert.False(t, app.IsReady())
+	assert.Equal(t, "source: connection refused", app.State().Reason)
+
+	since := app.State().Since
+	source.SetReady()
+	assert.True(t, app.IsReady())
+	assert.True(t, app.State().Since.After(since))
+
+	report := app.Report()
+	assert.Equal(t, "readiness_components", report.App)
+	assert.True(t, report.Ready)
+	require.Len(t, report.Components, 2)
+	assert.Equal(t, "database", report.Components[0].Name)
+	assert.Equal(t, "source", report.Components[1].Name)
+}
+
+func TestReadiness_Rollup(t *testing.T) {
+	useTestReadinessRegistry(t)
+	assert.True(t, IsReady())
+
+	first := NewSet().NewAppReadiness("readiness_rollup_a")
+	second := NewSet().NewAppReadiness("readiness_rollup_b")
+	assert.False(t, IsReady())
+
+	first.SetReady()
+	second.SetReady()
+	assert.True(t, IsReady())
+
+	second.SetNotReady("catching up")
+	assert.False(t, IsReady())
+
+	server := httptest.NewServer(ReadinessHandler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+
+	var report ReadinessReport
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&report))
+	assert.False(t, report.Ready)
+
+	require.Len(t, report.Apps, 2)
+	assert.Equal(t, "readiness_rollup_a", report.Apps[0].App)
+	assert.True(t, report.Apps[0].Ready)
+	assert.Equal(t, "readiness_rollup_b", report.Apps[1].App)
+	assert.False(t, report.Apps[1].Ready)
+	assert.Equal(t, "catching up", report.Apps[1].Reason)
+}
+
+// useTestReadinessRegistry swaps the process wide readiness registry for an empty one
+// for the duration of the test, and clears the process wide readiness metrics so the
+// tests never observe the state left by another one
+func useTestReadinessRegistry(t *testing.T) {
+	resetReadinessMetrics := func() {
+		appReady.Reset()
+		appReadySince.Reset()
+		appReadyTransitions.Reset()
+		readinessCheckDuration.Reset()
+		readinessCheckConsecutiveFailures.Reset()
+		readinessCheckLastError.Reset()
+	}
+
+	previous := readinessRegistry
+	readinessRegistry = &readinessApps{apps: map[string]*AppReadiness{}}
+	resetReadinessMetrics()
+
+	t.Cleanup(func() {
+		readinessRegistry = previous
+		resetReadinessMetrics()
+	})
+}
+
+func TestAppReadiness_OnChange(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_on_change")
+
+	type change struct{ old, new State }
+	var changes []change
+	unregister := app.OnChange(func(old, new State) {
+		changes = append(changes, change{old, new})
+
+		// Listeners are invoked outside of the lock and may modify the readiness
+		if new.Ready && !app.Component("late").IsReady() {
+			app.Component("late").SetReady()
+		}
+	})
+
+	app.SetNotReady("still initializing")
+	assert.Len(t, changes, 0, "reason change is not a flip")
+
+	app.SetReady()
+	require.Len(t, changes, 3)
+	assert.False(t, changes[0].old.Ready)
+	assert.True(t, changes[0].new.Ready)
+	assert.False(t, changes[1].new.Ready)
+	assert.Equal(t, "late: initializing", changes[1].new.Reason)
+	assert.True(t, changes[2].new.Ready)
+	assert.True(t, app.IsReady())
+
+	unregister()
+	app.SetNotReady("shutting down")
+	assert.Len(t, changes, 3)
+
+	history := app.History()
+	require.Len(t, history, 4)
+	assert.Equal(t, []bool{true, false, true, false}, []bool{history[0].Ready, history[1].Ready, history[2].Ready, history[3].Ready})
+	assert.Equal(t, "shutting down", history[3].Reason)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(appReadyTransitions.WithLabelValues("readiness_on_change", "ready")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(appReadyTransitions.WithLabelValues("readiness_on_change", "not_ready")))
+}
+
+func TestAppReadiness_HistoryBounded(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_history_bounded")
+	for i := 0; i < readinessHistorySize+5; i++ {
+		app.SetReady()
+		app.SetNotReady(fmt.Sprintf("flip %d", i))
+	}
+
+	history := app.History()
+	require.Len(t, history, readinessHistorySize)
+	assert.Equal(t, fmt.Sprintf("flip %d", readinessHistorySize+4), history[len(history)-1].Reason)
+}
+
+func TestAppReadiness_Watch(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_watch")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	states := app.Watch(ctx)
+
+	state := <-states
+	assert.False(t, state.Ready)
+
+	app.SetReady()
+	state = <-states
+	assert.True(t, state.Ready)
+
+	// A slow reader only sees the most recent state
+	app.SetNotReady("first")
+	app.SetReady()
+	app.SetNotReady("second")
+	state = <-states
+	assert.Equal(t, "second", state.Reason)
+
+	cancel()
+	select {
+	case _, ok := <-states:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("watch channel not closed after context cancellation")
+	}
+}
+
+func TestAppReadiness_WatchConcurrentChange(t *testing.T) {
+	useTestReadinessRegistry(t)
+
+	app := NewSet().NewAppReadiness("readiness_watch_concurrent")
+
+	for i := 0; i < 200; i++ {
+		app.SetNotReady("flipping")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		changed := make(chan struct{})
+		go func() {
+			app.SetReady()
+			close(changed)
+		}()
+
+		states := app.Watch(ctx)
+		<-changed
+
+		// The change is either part of the initial state or received afterward
+		state := <-states
+		if !state.Ready {
+			select {
+			case state = <-states:
+			case <-time.After(time.Second):
+				t.Fatal("change happening while watching was lost")
+			}
+		}
+		assert.True(t, state.Ready)
+		cancel()
+	}
+}
@@ -0,0 +1,352 @@
+// Package remotewrite implements a Prometheus remote write client that periodically
+// ships the metrics of a Prometheus gatherer to a remote write endpoint (Prometheus,
+// Mimir, Cortex, VictoriaMetrics, Grafana Cloud, etc.), useful for nodes that cannot
+// be scraped.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// Exporter gathers the metrics at a fixed interval and sends them to the remote
+// write endpoint. Payloads are queued in a bounded queue, so when the endpoint is
+// down, the oldest payloads are dropped once the queue is full while the newest
+// are retried with backoff.
+//
+// ```
+// registry := dmetrics.MustNewRegistry(bstream.MetricsSet)
+// exporter := remotewrite.NewExporter("https://prometheus/api/v1/write", registry, remotewrite.ExternalLabel("instance", hostname))
+// exporter.Start(ctx)
+// defer exporter.Close()
+// ```
+type Exporter struct {
+	endpoint       string
+	gatherer       prometheus.Gatherer
+	client         *http.Client
+	headers        http.Header
+	interval       time.Duration
+	externalLabels []label
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	queue     chan []byte
+	dropped   *atomic.Uint64
+	startOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+	closeErr  error
+}
+
+type Option func(e *Exporter)
+
+const defaultInterval = 15 * time.Second
+
+const defaultInitialBackoff = 500 * time.Millisecond
+const defaultMaxBackoff = 30 * time.Second
+
+// Interval configures at which interval the metrics are gathered and sent, defaults to 15s.
+// A zero or negative interval keeps the default.
+func Interval(interval time.Duration) Option {
+	return func(e *Exporter) {
+		e.interval = interval
+	}
+}
+
+// ExternalLabel adds a label to every series sent, the label is not added to series
+// that already define it. Can be used multiple times to define multiple labels.
+func ExternalLabel(name, value string) Option {
+	return func(e *Exporter) {
+		e.externalLabels = append(e.externalLabels, label{name, value})
+	}
+}
+
+// QueueSize configures how many payloads can be pending while the endpoint is
+// unreachable, defaults to 32. A size below 1 is clamped to 1, the newest payload
+// always needs a slot.
+func QueueSize(size int) Option {
+	return func(e *Exporter) {
+		if size < 1 {
+			size = 1
+		}
+
+		e.queue = make(chan []byte, size)
+	}
+}
+
+// Backoff configures how a failing send is retried, the backoff between attempts is
+// doubled after each failure starting at <initialBackoff> and capped at <maxBackoff>.
+// Defaults to a backoff starting at 500ms and capped at 30s. A zero or negative
+// <initialBackoff> keeps the default, and <maxBackoff> is raised to <initialBackoff>
+// when lower.
+func Backoff(initialBackoff time.Duration, maxBackoff time.Duration) Option {
+	return func(e *Exporter) {
+		e.initialBackoff = initialBackoff
+		e.maxBackoff = maxBackoff
+	}
+}
+
+// HTTPClient configures the HTTP client used to talk to the endpoint.
+func HTTPClient(client *http.Client) Option {
+	return func(e *Exporter) {
+		e.client = client
+	}
+}
+
+// Header adds a header to every request sent to the endpoint, useful for
+// authentication (e.g. `Authorization`) or tenant selection (e.g. `X-Scope-OrgID`).
+func Header(name, value string) Option {
+	return func(e *Exporter) {
+		e.headers.Add(name, value)
+	}
+}
+
+// NewExporter creates an [Exporter] sending the metrics of the gatherer to the given
+// remote write endpoint, use `dmetrics.NewRegistry` to send the metrics of one or
+// more `dmetrics.Set`.
+func NewExporter(endpoint string, gatherer prometheus.Gatherer, options ...Option) *Exporter {
+	e := &Exporter{
+		endpoint:       endpoint,
+		gatherer:       gatherer,
+		client:         &http.Client{Timeout: 30 * time.Second},
+		headers:        http.Header{},
+		interval:       defaultInterval,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		queue:          make(chan []byte, 32),
+		dropped:        atomic.NewUint64(0),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(e)
+	}
+
+	if e.interval <= 0 {
+		e.interval = defaultInterval
+	}
+
+	if e.initialBackoff <= 0 {
+		e.initialBackoff = defaultInitialBackoff
+	}
+
+	if e.maxBackoff < e.initialBackoff {
+		e.maxBackoff = e.initialBackoff
+	}
+
+	sort.Slice(e.externalLabels, func(i, j int) bool { return e.externalLabels[i].Name < e.externalLabels[j].Name })
+
+	return e
+}
+
+// Start launches the background goroutines gathering and sending the metrics. They
+// stop when the context is canceled or when [Exporter.Close] is called, whichever
+// comes first.
+func (e *Exporter) Start(ctx context.Context) {
+	e.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(ctx)
+		go func() {
+			defer cancel()
+
+			select {
+			case <-ctx.Done():
+			case <-e.stop:
+			}
+		}()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); e.gatherLoop(ctx) }()
+		go func() { defer wg.Done(); e.sendLoop(ctx) }()
+		go func() { wg.Wait(); close(e.done) }()
+	})
+}
+
+// Close stops the background goroutines, gathers the metrics one last time and
+// tries to send every pending payload once. The first error encountered while
+// flushing, if any, is returned.
+func (e *Exporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.stop)
+
+		// Ensures no more background work can be started
+		e.startOnce.Do(func() { close(e.done) })
+		<-e.done
+
+		// Pending payloads are older, send them first so the final one lands last
+		e.closeErr = e.flush()
+
+		if err := e.Enqueue(); err != nil && e.closeErr == nil {
+			e.closeErr = err
+		}
+
+		if err := e.flush(); err != nil && e.closeErr == nil {
+			e.closeErr = err
+		}
+	})
+
+	return e.closeErr
+}
+
+// flush tries to send every queued payload once, returning the first error encountered.
+func (e *Exporter) flush() (err error) {
+	for {
+		select {
+		case payload := <-e.queue:
+			if sendErr := e.send(payload); sendErr != nil && err == nil {
+				err = sendErr
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// Dropped returns the number of payloads dropped so far because the queue was full.
+func (e *Exporter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Enqueue gathers the metrics right now and queues the resulting payload for
+// sending, dropping the oldest pending payload if the queue is full.
+func (e *Exporter) Enqueue() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+
+	series := familiesToTimeSeries(families, e.externalLabels, time.Now().UnixNano()/int64(time.Millisecond))
+	if len(series) == 0 {
+		return nil
+	}
+
+	payload := snappy.Encode(nil, encodeWriteRequest(series))
+	for {
+		select {
+		case e.queue <- payload:
+			return nil
+		default:
+		}
+
+		// Queue is full, drop the oldest payload to make room for the newest one
+		select {
+		case <-e.queue:
+			dropped := e.dropped.Inc()
+			zlog.Debug("remote write queue full, dropped oldest payload", zap.Uint64("dropped", dropped))
+		default:
+		}
+	}
+}
+
+func (e *Exporter) gatherLoop(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.Enqueue(); err != nil {
+				zlog.Warn("unable to gather metrics for remote write", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Exporter) sendLoop(ctx context.Context) {
+	for {
+		select {
+		case payload := <-e.queue:
+			e.sendWithRetry(ctx, payload)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Exporter) sendWithRetry(ctx context.Context, payload []byte) {
+	backoff := e.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := e.send(payload)
+		if err == nil {
+			return
+		}
+
+		if _, ok := err.(nonRetryableError); ok {
+			zlog.Warn("remote write endpoint rejected payload, dropping it", zap.String("endpoint", e.endpoint), zap.Error(err))
+			return
+		}
+
+		zlog.Debug("remote write failed, retrying", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			// Put it back so the final flush gets a chance to send it
+			select {
+			case e.queue <- payload:
+			default:
+			}
+			return
+		}
+
+		backoff *= 2
+		if backoff > e.maxBackoff {
+			backoff = e.maxBackoff
+		}
+	}
+}
+
+type nonRetryableError struct {
+	error
+}
+
+func (e *Exporter) send(payload []byte) error {
+	request, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nonRetryableError{fmt.Errorf("new request: %w", err)}
+	}
+
+	for name, values := range e.headers {
+		request.Header[name] = values
+	}
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+	err = fmt.Errorf("unexpected status code %d from %s: %s", response.StatusCode, e.endpoint, bytes.TrimSpace(body))
+
+	// Same as Prometheus, client errors are not retried except for throttling
+	if response.StatusCode/100 == 4 && response.StatusCode != http.StatusTooManyRequests {
+		return nonRetryableError{err}
+	}
+
+	return err
+}
@@ -0,0 +1,263 @@
+package remotewrite
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testReceiver struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	status   int
+	requests [][]timeSeries
+}
+
+func newTestReceiver(t *testing.T) *testReceiver {
+	r := &testReceiver{status: http.StatusNoContent}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "snappy", req.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+		assert.Equal(t, "0.1.0", req.Header.Get("X-Prometheus-Remote-Write-Version"))
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		if r.status/100 != 2 {
+			w.WriteHeader(r.status)
+			return
+		}
+
+		compressed, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		payload, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		r.requests = append(r.requests, decodeWriteRequest(t, payload))
+		w.WriteHeader(r.status)
+	}))
+
+	return r
+}
+
+func (r *testReceiver) setStatus(status int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.status = status
+}
+
+func (r *testReceiver) received() [][]timeSeries {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([][]timeSeries(nil), r.requests...)
+}
+
+func TestExporter_Payload(t *testing.T) {
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks"}, []string{"source"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency", Buckets: []float64{1, 5}})
+	registry.MustRegister(counter, histogram)
+
+	counter.WithLabelValues("a").Add(3)
+	histogram.Observe(2)
+
+	exporter := NewExporter(receiver.URL, registry, ExternalLabel("source", "ignored"), ExternalLabel("instance", "node-1"))
+	require.NoError(t, exporter.Close())
+
+	requests := receiver.received()
+	require.Len(t, requests, 1)
+
+	series := map[string]float64{}
+	for _, s := range requests[0] {
+		require.Len(t, s.Samples, 1)
+		assert.NotZero(t, s.Samples[0].Timestamp)
+		series[labelsString(s.Labels)] = s.Samples[0].Value
+	}
+
+	assert.Equal(t, map[string]float64{
+		`__name__="blocks",instance="node-1",source="a"`:                         3,
+		`__name__="latency_bucket",instance="node-1",le="1",source="ignored"`:    0,
+		`__name__="latency_bucket",instance="node-1",le="5",source="ignored"`:    1,
+		`__name__="latency_bucket",instance="node-1",le="+Inf",source="ignored"`: 1,
+		`__name__="latency_sum",instance="node-1",source="ignored"`:              2,
+		`__name__="latency_count",instance="node-1",source="ignored"`:            1,
+	}, series)
+}
+
+func TestExporter_Periodic(t *testing.T) {
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge"}))
+
+	exporter := NewExporter(receiver.URL, registry, Interval(10*time.Millisecond))
+	exporter.Start(context.Background())
+
+	require.Eventually(t, func() bool { return len(receiver.received()) >= 2 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, exporter.Close())
+}
+
+func TestExporter_BoundedQueue(t *testing.T) {
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+	receiver.setStatus(http.StatusServiceUnavailable)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge"}))
+
+	exporter := NewExporter(receiver.URL, registry, QueueSize(2))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, exporter.Enqueue())
+	}
+	assert.EqualValues(t, 3, exporter.Dropped())
+
+	receiver.setStatus(http.StatusNoContent)
+	require.NoError(t, exporter.Close())
+
+	// The two queued payloads and the final one gathered on close
+	assert.Len(t, receiver.received(), 3)
+}
+
+func TestExporter_InvalidOptions(t *testing.T) {
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+	receiver.setStatus(http.StatusServiceUnavailable)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge"}))
+
+	for _, size := range []int{0, -1} {
+		exporter := NewExporter(receiver.URL, registry, QueueSize(size), Interval(-time.Second))
+		assert.Equal(t, defaultInterval, exporter.interval)
+		assert.Equal(t, 1, cap(exporter.queue))
+
+		require.NoError(t, exporter.Enqueue())
+		require.NoError(t, exporter.Enqueue())
+		assert.EqualValues(t, 1, exporter.Dropped())
+	}
+
+	for _, initialBackoff := range []time.Duration{0, -time.Second} {
+		exporter := NewExporter(receiver.URL, registry, Backoff(initialBackoff, 0))
+		assert.Equal(t, defaultInitialBackoff, exporter.initialBackoff)
+		assert.Equal(t, defaultInitialBackoff, exporter.maxBackoff)
+	}
+
+	exporter := NewExporter(receiver.URL, registry, Backoff(time.Second, 10*time.Millisecond))
+	assert.Equal(t, time.Second, exporter.initialBackoff)
+	assert.Equal(t, time.Second, exporter.maxBackoff)
+}
+
+func TestExporter_Retry(t *testing.T) {
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+	receiver.setStatus(http.StatusInternalServerError)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge"}))
+
+	exporter := NewExporter(receiver.URL, registry, Interval(time.Hour), Backoff(time.Millisecond, 5*time.Millisecond))
+	require.NoError(t, exporter.Enqueue())
+	exporter.Start(context.Background())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, receiver.received(), 0)
+
+	receiver.setStatus(http.StatusNoContent)
+	require.Eventually(t, func() bool { return len(receiver.received()) == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, exporter.Close())
+}
+
+func labelsString(labels []label) (out string) {
+	for i, l := range labels {
+		if i > 0 {
+			out += ","
+		}
+		out += l.Name + `="` + l.Value + `"`
+	}
+	return
+}
+
+func decodeWriteRequest(t *testing.T, payload []byte) (out []timeSeries) {
+	t.Helper()
+
+	forEachField(t, payload, func(number protowire.Number, value []byte) {
+		require.Equal(t, protowire.Number(writeRequestTimeSeriesField), number)
+
+		var series timeSeries
+		forEachField(t, value, func(number protowire.Number, value []byte) {
+			switch number {
+			case timeSeriesLabelsField:
+				var l label
+				forEachField(t, value, func(number protowire.Number, value []byte) {
+					if number == labelNameField {
+						l.Name = string(value)
+					} else {
+						l.Value = string(value)
+					}
+				})
+				series.Labels = append(series.Labels, l)
+
+			case timeSeriesSamplesField:
+				var s sample
+				for len(value) > 0 {
+					number, typ, n := protowire.ConsumeTag(value)
+					require.True(t, n > 0)
+					value = value[n:]
+
+					if number == sampleValueField {
+						require.Equal(t, protowire.Fixed64Type, typ)
+						bits, n := protowire.ConsumeFixed64(value)
+						require.True(t, n > 0)
+						s.Value = math.Float64frombits(bits)
+						value = value[n:]
+					} else {
+						require.Equal(t, protowire.VarintType, typ)
+						timestamp, n := protowire.ConsumeVarint(value)
+						require.True(t, n > 0)
+						s.Timestamp = int64(timestamp)
+						value = value[n:]
+					}
+				}
+				series.Samples = append(series.Samples, s)
+			}
+		})
+
+		out = append(out, series)
+	})
+
+	return out
+}
+
+func forEachField(t *testing.T, payload []byte, f func(number protowire.Number, value []byte)) {
+	for len(payload) > 0 {
+		number, typ, n := protowire.ConsumeTag(payload)
+		require.True(t, n > 0)
+		require.Equal(t, protowire.BytesType, typ)
+		payload = payload[n:]
+
+		value, n := protowire.ConsumeBytes(payload)
+		require.True(t, n > 0)
+		payload = payload[n:]
+
+		f(number, value)
+	}
+}
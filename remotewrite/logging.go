@@ -0,0 +1,7 @@
+package remotewrite
+
+import (
+	"github.com/streamingfast/logging"
+)
+
+var zlog, _ = logging.PackageLogger("remotewrite", "github.com/streamingfast/dmetrics/remotewrite")
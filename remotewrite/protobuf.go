@@ -0,0 +1,78 @@
+package remotewrite
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The remote write protocol payload is small enough that we encode it by hand instead
+// of depending on the `prompb` package which would drag the whole Prometheus server
+// module with it. See https://github.com/prometheus/prometheus/blob/main/prompb/types.proto
+// for the definitions being encoded here.
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+const (
+	writeRequestTimeSeriesField = 1
+	timeSeriesLabelsField       = 1
+	timeSeriesSamplesField      = 2
+	labelNameField              = 1
+	labelValueField             = 2
+	sampleValueField            = 1
+	sampleTimestampField        = 2
+)
+
+type label struct {
+	Name  string
+	Value string
+}
+
+type sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+type timeSeries struct {
+	Labels  []label
+	Samples []sample
+}
+
+func encodeWriteRequest(series []timeSeries) []byte {
+	var out []byte
+	for _, s := range series {
+		out = protowire.AppendTag(out, writeRequestTimeSeriesField, protowire.BytesType)
+		out = protowire.AppendBytes(out, encodeTimeSeries(s))
+	}
+
+	return out
+}
+
+func encodeTimeSeries(s timeSeries) []byte {
+	var out []byte
+	for _, l := range s.Labels {
+		var encoded []byte
+		encoded = protowire.AppendTag(encoded, labelNameField, protowire.BytesType)
+		encoded = protowire.AppendString(encoded, l.Name)
+		encoded = protowire.AppendTag(encoded, labelValueField, protowire.BytesType)
+		encoded = protowire.AppendString(encoded, l.Value)
+
+		out = protowire.AppendTag(out, timeSeriesLabelsField, protowire.BytesType)
+		out = protowire.AppendBytes(out, encoded)
+	}
+
+	for _, sm := range s.Samples {
+		var encoded []byte
+		encoded = protowire.AppendTag(encoded, sampleValueField, protowire.Fixed64Type)
+		encoded = protowire.AppendFixed64(encoded, math.Float64bits(sm.Value))
+		encoded = protowire.AppendTag(encoded, sampleTimestampField, protowire.VarintType)
+		encoded = protowire.AppendVarint(encoded, uint64(sm.Timestamp))
+
+		out = protowire.AppendTag(out, timeSeriesSamplesField, protowire.BytesType)
+		out = protowire.AppendBytes(out, encoded)
+	}
+
+	return out
+}
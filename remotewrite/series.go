@@ -0,0 +1,96 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// familiesToTimeSeries flattens the gathered metric families into remote write time
+// series, following the same naming rules as the text exposition format for
+// histograms and summaries (`_bucket`, `_sum` and `_count` suffixes).
+func familiesToTimeSeries(families []*dto.MetricFamily, externalLabels []label, defaultTimestamp int64) (out []timeSeries) {
+	for _, family := range families {
+		name := family.GetName()
+
+		for _, metric := range family.Metric {
+			timestamp := defaultTimestamp
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+
+			add := func(name string, value float64, extra ...label) {
+				out = append(out, timeSeries{
+					Labels:  seriesLabels(name, metric.Label, externalLabels, extra),
+					Samples: []sample{{Value: value, Timestamp: timestamp}},
+				})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, metric.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.Quantile {
+					add(name, quantile.GetValue(), label{"quantile", formatFloat(quantile.GetQuantile())})
+				}
+				add(name+"_sum", summary.GetSampleSum())
+				add(name+"_count", float64(summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.Bucket {
+					add(name+"_bucket", float64(bucket.GetCumulativeCount()), label{"le", formatFloat(bucket.GetUpperBound())})
+				}
+				if len(histogram.Bucket) == 0 || !math.IsInf(histogram.Bucket[len(histogram.Bucket)-1].GetUpperBound(), +1) {
+					add(name+"_bucket", float64(histogram.GetSampleCount()), label{"le", "+Inf"})
+				}
+				add(name+"_sum", histogram.GetSampleSum())
+				add(name+"_count", float64(histogram.GetSampleCount()))
+			}
+		}
+	}
+
+	return out
+}
+
+// seriesLabels builds the sorted label set of a series, the remote write protocol
+// requires labels to be sorted by name. External labels never override the labels
+// of the metric itself, same as Prometheus does.
+func seriesLabels(name string, pairs []*dto.LabelPair, externalLabels []label, extra []label) []label {
+	labels := make([]label, 0, 1+len(pairs)+len(extra)+len(externalLabels))
+	labels = append(labels, label{"__name__", name})
+	seen := map[string]bool{"__name__": true}
+
+	for _, pair := range pairs {
+		labels = append(labels, label{pair.GetName(), pair.GetValue()})
+		seen[pair.GetName()] = true
+	}
+
+	for _, l := range extra {
+		labels = append(labels, l)
+		seen[l.Name] = true
+	}
+
+	for _, l := range externalLabels {
+		if !seen[l.Name] {
+			labels = append(labels, l)
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, +1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,213 @@
+package dmetrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Reporter periodically logs the values of local counters as a single structured
+// log line, each counter registered being a field of the line. The line is not
+// logged when the total of no counter changed since the last one, and a final line
+// is logged when the Reporter is stopped so the last values are never lost. The
+// counters without a total, like [PercentileDurationCounter], are logged along but
+// never trigger the line by themselves.
+//
+// ```
+// reporter := dmetrics.NewReporter(dmetrics.ReportLogger(zlog), dmetrics.ReportMessage("block processing stats"))
+// reporter.Register("blocks", blockRate)
+// reporter.Register("block_duration", blockDuration)
+// reporter.Start(ctx)
+// defer reporter.Stop()
+//
+// // INFO block processing stats {"blocks": {"rate": 12, "total": 2883, "unit": "blocks", "window_seconds": 1}, "block_duration": {...}}
+// ```
+type Reporter struct {
+	logger   *zap.Logger
+	message  string
+	interval time.Duration
+	clock    Clock
+
+	lock         sync.Mutex
+	entries      []reporterEntry
+	reported     bool
+	lastProgress map[string]string
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+type reporterEntry struct {
+	name    string
+	counter fmt.Stringer
+}
+
+type ReporterOption func(r *Reporter)
+
+const defaultReportInterval = 15 * time.Second
+
+// ReportInterval configures at which interval the line is logged, defaults to 15s. A
+// zero or negative interval keeps the default.
+func ReportInterval(interval time.Duration) ReporterOption {
+	return func(r *Reporter) {
+		r.interval = interval
+	}
+}
+
+// ReportLogger configures the logger used to log the line, defaults to the logger
+// of this package.
+func ReportLogger(logger *zap.Logger) ReporterOption {
+	return func(r *Reporter) {
+		r.logger = logger
+	}
+}
+
+// ReportMessage configures the message of the line, defaults to "progress".
+func ReportMessage(message string) ReporterOption {
+	return func(r *Reporter) {
+		r.message = message
+	}
+}
+
+// ReportClock configures the clock driving the interval, defaults to [RealClock].
+func ReportClock(clock Clock) ReporterOption {
+	return func(r *Reporter) {
+		r.clock = clock
+	}
+}
+
+func NewReporter(options ...ReporterOption) *Reporter {
+	r := &Reporter{
+		logger:       zlog,
+		message:      "progress",
+		interval:     defaultReportInterval,
+		clock:        RealClock,
+		lastProgress: map[string]string{},
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	if r.interval <= 0 {
+		r.interval = defaultReportInterval
+	}
+
+	return r
+}
+
+// Register adds a counter to the line under the given name, the counters being
+// logged in the order they were registered. The counters implementing
+// [zapcore.ObjectMarshaler], like the local counters of this package, are logged as
+// structured fields using their own schema, any other counter is logged using its
+// String() value under the `value` field.
+func (r *Reporter) Register(name string, counter fmt.Stringer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.entries = append(r.entries, reporterEntry{name, counter})
+}
+
+// Start launches the background goroutine logging the line at the configured
+// interval. Logging stops when the context is canceled or when [Reporter.Stop] is
+// called, whichever comes first.
+func (r *Reporter) Start(ctx context.Context) {
+	r.startOnce.Do(func() {
+		go r.run(ctx, r.clock.NewTicker(r.interval))
+	})
+}
+
+// Stop stops the periodic logging and logs a final line if some counters made
+// progress since the last one. Calling it multiple times is safe.
+func (r *Reporter) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+
+		// Ensures the goroutine is never started after a stop
+		r.startOnce.Do(func() { close(r.done) })
+		<-r.done
+
+		r.Report()
+	})
+}
+
+func (r *Reporter) run(ctx context.Context, ticker Ticker) {
+	defer close(r.done)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			r.Report()
+		case <-ctx.Done():
+			return
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Report logs the line right now, unless no counter made progress since the last
+// one, the first line being always logged. It returns whether the line was logged.
+func (r *Reporter) Report() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	changed := !r.reported
+	fields := make([]zap.Field, len(r.entries))
+	for i, entry := range r.entries {
+		marshaler := reportMarshaler(entry.counter)
+
+		encoder := zapcore.NewMapObjectEncoder()
+		if err := marshaler.MarshalLogObject(encoder); err != nil {
+			fields[i] = zap.NamedError(entry.name, err)
+			continue
+		}
+
+		if progress, ok := reportProgress(encoder.Fields); ok && r.lastProgress[entry.name] != progress {
+			r.lastProgress[entry.name] = progress
+			changed = true
+		}
+
+		fields[i] = zap.Object(entry.name, marshaler)
+	}
+
+	if !changed {
+		return false
+	}
+
+	r.reported = true
+	r.logger.Info(r.message, fields...)
+	return true
+}
+
+// reportProgress returns the total of a counter, which identifies its progress, false
+// if the counter has no total.
+func reportProgress(fields map[string]interface{}) (string, bool) {
+	for _, key := range []string{"total", "total_seconds"} {
+		if total, found := fields[key]; found {
+			return fmt.Sprint(total), true
+		}
+	}
+
+	return "", false
+}
+
+func reportMarshaler(counter fmt.Stringer) zapcore.ObjectMarshaler {
+	if marshaler, ok := counter.(zapcore.ObjectMarshaler); ok {
+		return marshaler
+	}
+
+	return zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("value", counter.String())
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package dmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestReporter(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	clock := NewFakeClock(time.Unix(0, 0))
+
+	reporter := NewReporter(ReportLogger(zap.New(core)), ReportMessage("stats"), ReportInterval(10*time.Second), ReportClock(clock))
+
+	blocks := NewRateCounter(time.Minute, "blocks")
+	duration := NewAvgDurationCounter(time.Minute, time.Millisecond, "per block")
+	reporter.Register("blocks", blocks)
+	reporter.Register("block_duration", duration)
+
+	blocks.IncBy(3)
+	duration.AddDuration(20 * time.Millisecond)
+
+	reporter.Start(context.Background())
+	clock.Advance(10 * time.Second)
+
+	require.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, time.Millisecond)
+	entry := logs.All()[0]
+	assert.Equal(t, "stats", entry.Message)
+	assert.Equal(t, map[string]interface{}{
+		"blocks":         map[string]interface{}{"rate": int64(3), "total": uint64(3), "unit": "blocks", "window_seconds": 60.0},
+		"block_duration": map[string]interface{}{"average_seconds": 0.02, "total_seconds": 0.02, "description": "per block", "window_seconds": 60.0},
+	}, entry.ContextMap())
+
+	// Nothing changed, nothing is logged
+	assert.False(t, reporter.Report())
+
+	// The final line is logged on stop since a counter made progress
+	blocks.Inc()
+	reporter.Stop()
+	reporter.Stop()
+
+	require.Equal(t, 2, logs.Len())
+	assert.Equal(t, uint64(4), logs.All()[1].ContextMap()["blocks"].(map[string]interface{})["total"])
+}
+
+func TestReporter_StopWithoutProgress(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	reporter := NewReporter(ReportLogger(zap.New(core)))
+	reporter.Register("blocks", NewRateCounter(time.Second, "blocks"))
+
+	assert.True(t, reporter.Report(), "first line is always logged")
+	reporter.Stop()
+
+	assert.Equal(t, 1, logs.Len())
+}
+
+func TestReporter_Fields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	clock := NewFakeClock(time.Unix(0, 0))
+
+	rate := MustNewAvgRateCounter(time.Second, 2*time.Second, "blocks", CounterClock(clock))
+	defer rate.Stop()
+
+	promBlocks := prometheus.NewCounter(prometheus.CounterOpts{Name: "blocks"})
+	promRate := MustNewAvgRateFromPromCounter(promBlocks, time.Second, 2*time.Second, "blocks", CounterClock(clock))
+	defer promRate.Stop()
+
+	events := NewAvgCounter(time.Minute, "cache hits")
+	events.IncBy(10)
+
+	reporter := NewReporter(ReportLogger(zap.New(core)))
+	reporter.Register("rate", rate)
+	reporter.Register("prom_rate", promRate)
+	reporter.Register("cache", events)
+	reporter.Register("head", stringer("block #12"))
+
+	rate.Add(4)
+	promBlocks.Add(6)
+	rate.SyncNow()
+	promRate.SyncNow()
+
+	require.True(t, reporter.Report())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, map[string]interface{}{"rate": 4.0, "total": 4.0, "unit": "blocks", "window_seconds": 1.0, "period_seconds": 2.0}, fields["rate"])
+	assert.Equal(t, map[string]interface{}{"rate": 6.0, "total": 6.0, "unit": "blocks", "window_seconds": 1.0, "period_seconds": 2.0}, fields["prom_rate"])
+	assert.Equal(t, uint64(10), fields["cache"].(map[string]interface{})["total"])
+	assert.Equal(t, map[string]interface{}{"value": "block #12"}, fields["head"])
+}
+
+func TestReporter_CounterWithoutTotal(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	blocks := NewRateCounter(time.Minute, "blocks")
+	latency := MustNewPercentileDurationCounter(time.Second, 10*time.Second, time.Millisecond)
+
+	reporter := NewReporter(ReportLogger(zap.New(core)))
+	reporter.Register("blocks", blocks)
+	reporter.Register("latency", latency)
+
+	latency.AddDuration(10 * time.Millisecond)
+	assert.True(t, reporter.Report(), "first line is always logged")
+
+	// The percentiles moving alone is not progress
+	latency.AddDuration(500 * time.Millisecond)
+	assert.False(t, reporter.Report())
+
+	blocks.Inc()
+	assert.True(t, reporter.Report())
+	assert.Equal(t, 2, logs.Len())
+	assert.InDelta(t, 0.5, logs.All()[1].ContextMap()["latency"].(map[string]interface{})["p99_seconds"], 0.01)
+}
+
+func TestReporter_InvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		reporter := NewReporter(ReportInterval(interval))
+		assert.Equal(t, defaultReportInterval, reporter.interval)
+
+		reporter.Start(context.Background())
+		reporter.Stop()
+	}
+}
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
@@ -0,0 +1,131 @@
+package dmetrics
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ prometheus.Collector = (*RateCounter)(nil)
+var _ prometheus.Collector = (*AvgCounter)(nil)
+var _ prometheus.Collector = (*AvgRateCounter)(nil)
+var _ prometheus.Collector = (*AvgDurationCounter)(nil)
+
+// scrapeGauges exposes values computed at collection time as gauges, or as counters
+// for the totals. It is embedded by the local counters so the ones created through a
+// Set are also collectors, it is nil for the ones created standalone which then
+// collect nothing.
+type scrapeGauges struct {
+	descs      []*prometheus.Desc
+	valueTypes []prometheus.ValueType
+	values     []func() float64
+}
+
+func (g *scrapeGauges) gauge(name string, help string, value func() float64) *scrapeGauges {
+	return g.add(name, help, prometheus.GaugeValue, value)
+}
+
+// counter is for the values that never decrease, like the `_total` series
+func (g *scrapeGauges) counter(name string, help string, value func() float64) *scrapeGauges {
+	return g.add(name, help, prometheus.CounterValue, value)
+}
+
+func (g *scrapeGauges) add(name string, help string, valueType prometheus.ValueType, value func() float64) *scrapeGauges {
+	g.descs = append(g.descs, prometheus.NewDesc(name, help, nil, nil))
+	g.valueTypes = append(g.valueTypes, valueType)
+	g.values = append(g.values, value)
+
+	return g
+}
+
+func (g *scrapeGauges) Describe(in chan<- *prometheus.Desc) {
+	if g == nil {
+		return
+	}
+
+	for _, desc := range g.descs {
+		in <- desc
+	}
+}
+
+func (g *scrapeGauges) Collect(in chan<- prometheus.Metric) {
+	if g == nil {
+		return
+	}
+
+	for i, desc := range g.descs {
+		in <- prometheus.MustNewConstMetric(desc, g.valueTypes[i], g.values[i]())
+	}
+}
+
+// NewRateCounter creates a [RateCounter] whose rate and total are exposed as the
+// `<name>_rate` gauge and `<name>_total` counter of the set. See [NewRateCounter].
+func (s *Set) NewRateCounter(name string, interval time.Duration, unit string) *RateCounter {
+	c := NewRateCounter(interval, unit)
+
+	name = s.computeMetricName(name)
+	c.scrapeGauges = (&scrapeGauges{}).
+		gauge(name+"_rate", "Number of "+unit+" in the last "+interval.String(), func() float64 { return float64(c.Rate()) }).
+		counter(name+"_total", "Total number of "+unit, func() float64 { return float64(c.Total()) })
+
+	return s.add(c).(*RateCounter)
+}
+
+// NewAvgCounter creates an [AvgCounter] whose average and total are exposed as the
+// `<name>_average` gauge and `<name>_total` counter of the set. See [NewAvgCounter].
+func (s *Set) NewAvgCounter(name string, samplingWindow time.Duration, eventType string) *AvgCounter {
+	c := NewAvgCounter(samplingWindow, eventType)
+
+	name = s.computeMetricName(name)
+	c.scrapeGauges = (&scrapeGauges{}).
+		gauge(name+"_average", "Average "+eventType+" over the last "+samplingWindow.String(), c.Average).
+		counter(name+"_total", "Total "+eventType, func() float64 { return float64(c.Total()) })
+
+	return s.add(c).(*AvgCounter)
+}
+
+// MustNewAvgRateCounter acts like [Set.NewAvgRateCounter] but panics if an error occurs.
+func (s *Set) MustNewAvgRateCounter(name string, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) *AvgRateCounter {
+	c, err := s.NewAvgRateCounter(name, samplingWindow, period, unit, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewAvgRateCounter creates an [AvgRateCounter] whose rate and total are exposed as
+// the `<name>_rate` gauge and `<name>_total` counter of the set, the rate being 0 until
+// enough samples are taken. See [NewAvgRateCounter].
+func (s *Set) NewAvgRateCounter(name string, samplingWindow time.Duration, period time.Duration, unit string, options ...CounterOption) (*AvgRateCounter, error) {
+	c, err := NewAvgRateCounter(samplingWindow, period, unit, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	name = s.computeMetricName(name)
+	c.scrapeGauges = (&scrapeGauges{}).
+		gauge(name+"_rate", "Average number of "+unit+" per "+samplingWindow.String()+" over the last "+period.String(), func() float64 {
+			if rate := c.Rate(); !math.IsNaN(rate) {
+				return rate
+			}
+			return 0
+		}).
+		counter(name+"_total", "Total number of "+unit, func() float64 { return float64(c.Total()) })
+
+	return s.add(c).(*AvgRateCounter), nil
+}
+
+// NewAvgDurationCounter creates an [AvgDurationCounter] whose average and total are
+// exposed as the `<name>_average_seconds` gauge and `<name>_total_seconds` counter
+// of the set. See [NewAvgDurationCounter].
+func (s *Set) NewAvgDurationCounter(name string, samplingWindow time.Duration, unit time.Duration, description string, options ...CounterOption) *AvgDurationCounter {
+	c := NewAvgDurationCounter(samplingWindow, unit, description, options...)
+
+	name = s.computeMetricName(name)
+	c.scrapeGauges = (&scrapeGauges{}).
+		gauge(name+"_average_seconds", "Average duration "+description+" over the last "+samplingWindow.String(), func() float64 { return c.Average().Seconds() }).
+		counter(name+"_total_seconds", "Total duration "+description, func() float64 { return c.Total().Seconds() })
+
+	return s.add(c).(*AvgDurationCounter)
+}
@@ -0,0 +1,72 @@
+package dmetrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet_LocalCounters(t *testing.T) {
+	collector := hookTestRegister()
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	set := NewSet(PrefixNameWith("indexer"))
+
+	events := set.NewRateCounter("events", time.Minute, "events")
+	hits := set.NewAvgCounter("cache_hits", time.Minute, "cache hits")
+	blocks := set.MustNewAvgRateCounter("blocks", time.Second, 2*time.Second, "blocks", CounterClock(clock))
+	defer blocks.Stop()
+	durations := set.NewAvgDurationCounter("block_processing", time.Minute, time.Second, "per block")
+
+	events.IncBy(3)
+	hits.IncBy(4)
+	hits.IncBy(6)
+	durations.AddDuration(2 * time.Second)
+	durations.AddDuration(4 * time.Second)
+
+	for i, count := range []uint64{0, 10, 20} {
+		blocks.Add(count)
+		clock.Advance(time.Second)
+		waitSamples(t, blocks.avgRate, uint64(i+1))
+	}
+
+	expected := `
+		# HELP indexer_block_processing_average_seconds Average duration per block over the last 1m0s
+		# TYPE indexer_block_processing_average_seconds gauge
+		indexer_block_processing_average_seconds 3
+		# HELP indexer_block_processing_total_seconds Total duration per block
+		# TYPE indexer_block_processing_total_seconds counter
+		indexer_block_processing_total_seconds 6
+		# HELP indexer_blocks_rate Average number of blocks per 1s over the last 2s
+		# TYPE indexer_blocks_rate gauge
+		indexer_blocks_rate 15
+		# HELP indexer_blocks_total Total number of blocks
+		# TYPE indexer_blocks_total counter
+		indexer_blocks_total 30
+		# HELP indexer_cache_hits_average Average cache hits over the last 1m0s
+		# TYPE indexer_cache_hits_average gauge
+		indexer_cache_hits_average 5
+		# HELP indexer_cache_hits_total Total cache hits
+		# TYPE indexer_cache_hits_total counter
+		indexer_cache_hits_total 10
+		# HELP indexer_events_rate Number of events in the last 1m0s
+		# TYPE indexer_events_rate gauge
+		indexer_events_rate 3
+		# HELP indexer_events_total Total number of events
+		# TYPE indexer_events_total counter
+		indexer_events_total 3
+	`
+	assert.NoError(t, testutil.GatherAndCompare(MustNewRegistry(set), strings.NewReader(expected)))
+
+	set.Register()
+	assert.Equal(t, 4, collector.count())
+}
+
+func TestLocalCounters_StandaloneCollectNothing(t *testing.T) {
+	assert.Equal(t, 0, testutil.CollectAndCount(NewRateCounter(time.Second, "events")))
+	assert.Equal(t, 0, testutil.CollectAndCount(NewAvgCounter(time.Second, "events")))
+	assert.Equal(t, 0, testutil.CollectAndCount(NewAvgDurationCounter(time.Second, time.Second, "events")))
+}
@@ -0,0 +1,376 @@
+// Package statsd implements an exporter periodically sending the metrics of a
+// Prometheus gatherer over UDP in the DogStatsD format, so they can be ingested by
+// a Datadog agent (or any StatsD server understanding the tags extension).
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// HistogramMode defines how Prometheus histograms are sent to the agent.
+type HistogramMode int
+
+const (
+	// HistogramSummary sends the `count` and `sum` of the observations made since the
+	// last flush as counters and their average as a gauge.
+	HistogramSummary HistogramMode = iota
+
+	// HistogramDistribution sends one distribution point per bucket that received
+	// observations since the last flush, valued at the bucket's upper bound and
+	// weighted by the number of observations through the sample rate.
+	HistogramDistribution
+)
+
+// Exporter gathers the metrics at a fixed interval and sends them to a DogStatsD
+// agent. Counters are sent as deltas since the previous flush, gauges as their
+// current value and histograms according to the configured [HistogramMode]. The
+// labels of each series are sent as tags.
+//
+// ```
+// exporter, err := statsd.NewExporter("127.0.0.1:8125", dmetrics.MustNewRegistry(bstream.MetricsSet), statsd.Prefix("firehose"))
+// exporter.Start(ctx)
+// defer exporter.Close()
+// ```
+type Exporter struct {
+	addr          string
+	conn          net.Conn
+	gatherer      prometheus.Gatherer
+	prefix        string
+	tags          []string
+	interval      time.Duration
+	maxPacketSize int
+	histogramMode HistogramMode
+
+	lock     sync.Mutex
+	previous map[string]float64
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+	closeErr  error
+}
+
+type Option func(e *Exporter)
+
+// Prefix configures the prefix of every metric name sent, a `.` is added between
+// the prefix and the metric name. An empty prefix sends the metric names as is.
+func Prefix(prefix string) Option {
+	return func(e *Exporter) {
+		e.prefix = ""
+		if prefix = strings.TrimSuffix(prefix, "."); prefix != "" {
+			e.prefix = prefix + "."
+		}
+	}
+}
+
+// Tag adds a constant tag to every metric sent. Can be used multiple times to define
+// multiple tags.
+func Tag(name, value string) Option {
+	return func(e *Exporter) {
+		e.tags = append(e.tags, formatTag(name, value))
+	}
+}
+
+const defaultFlushInterval = 10 * time.Second
+
+// FlushInterval configures at which interval the metrics are gathered and sent,
+// defaults to 10s which is the Datadog agent's own flush interval. A zero or
+// negative interval keeps the default.
+func FlushInterval(interval time.Duration) Option {
+	return func(e *Exporter) {
+		e.interval = interval
+	}
+}
+
+// MaxPacketSize configures the maximum size of a single UDP datagram, defaults to
+// 1432 bytes which fits in an Ethernet frame. Use a bigger value (e.g. 8192) when
+// sending over a local interface.
+func MaxPacketSize(size int) Option {
+	return func(e *Exporter) {
+		e.maxPacketSize = size
+	}
+}
+
+// Histograms configures how Prometheus histograms are sent, defaults to [HistogramSummary].
+func Histograms(mode HistogramMode) Option {
+	return func(e *Exporter) {
+		e.histogramMode = mode
+	}
+}
+
+// NewExporter creates an [Exporter] sending the metrics of the gatherer to the agent
+// listening at <addr>, use `dmetrics.NewRegistry` to send the metrics of one or more
+// `dmetrics.Set`.
+func NewExporter(addr string, gatherer prometheus.Gatherer, options ...Option) (*Exporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %q: %w", addr, err)
+	}
+
+	e := &Exporter{
+		addr:          addr,
+		conn:          conn,
+		gatherer:      gatherer,
+		interval:      defaultFlushInterval,
+		maxPacketSize: 1432,
+		previous:      map[string]float64{},
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(e)
+	}
+
+	if e.interval <= 0 {
+		e.interval = defaultFlushInterval
+	}
+
+	return e, nil
+}
+
+// Start launches the background goroutine flushing the metrics at the configured
+// interval. Flushing stops when the context is canceled or when [Exporter.Close] is
+// called, whichever comes first.
+func (e *Exporter) Start(ctx context.Context) {
+	e.startOnce.Do(func() {
+		go e.run(ctx)
+	})
+}
+
+func (e *Exporter) run(ctx context.Context) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.Flush(); err != nil {
+				zlog.Warn("unable to flush metrics to statsd", zap.String("addr", e.addr), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flushes, performs a final flush and closes the UDP
+// connection. The error of the final flush, if any, is returned.
+func (e *Exporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.stop)
+
+		// Ensures no more flush can be started by the background goroutine
+		e.startOnce.Do(func() { close(e.done) })
+		<-e.done
+
+		e.closeErr = e.Flush()
+		if err := e.conn.Close(); err != nil && e.closeErr == nil {
+			e.closeErr = err
+		}
+	})
+
+	return e.closeErr
+}
+
+// Flush gathers the metrics and sends them right now.
+func (e *Exporter) Flush() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	packet := &bytes.Buffer{}
+	for _, line := range e.lines(families) {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > e.maxPacketSize {
+			if err := e.send(packet); err != nil {
+				return err
+			}
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		return e.send(packet)
+	}
+
+	return nil
+}
+
+func (e *Exporter) send(packet *bytes.Buffer) error {
+	defer packet.Reset()
+
+	if _, err := e.conn.Write(packet.Bytes()); err != nil {
+		return fmt.Errorf("write packet: %w", err)
+	}
+
+	return nil
+}
+
+// lines converts the metric families into DogStatsD lines, it must be called with
+// the lock held since it updates the previous values used to compute deltas.
+func (e *Exporter) lines(families []*dto.MetricFamily) (out []string) {
+	for _, family := range families {
+		name := e.prefix + family.GetName()
+
+		for _, metric := range family.Metric {
+			tags := e.metricTags(metric.Label)
+			key := seriesKey(name, tags)
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				if delta, ok := e.delta(key, metric.GetCounter().GetValue()); ok {
+					out = append(out, formatLine(name, delta, "c", 1, tags))
+				}
+
+			case dto.MetricType_GAUGE:
+				out = append(out, formatLine(name, metric.GetGauge().GetValue(), "g", 1, tags))
+
+			case dto.MetricType_UNTYPED:
+				out = append(out, formatLine(name, metric.GetUntyped().GetValue(), "g", 1, tags))
+
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.Quantile {
+					quantileTags := append(append([]string(nil), tags...), formatTag("quantile", formatFloat(quantile.GetQuantile())))
+					out = append(out, formatLine(name, quantile.GetValue(), "g", 1, quantileTags))
+				}
+				out = append(out, e.summaryLines(name, key, float64(summary.GetSampleCount()), summary.GetSampleSum(), tags)...)
+
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				if e.histogramMode == HistogramDistribution {
+					out = append(out, e.distributionLines(name, key, histogram, tags)...)
+					continue
+				}
+				out = append(out, e.summaryLines(name, key, float64(histogram.GetSampleCount()), histogram.GetSampleSum(), tags)...)
+			}
+		}
+	}
+
+	return out
+}
+
+func (e *Exporter) summaryLines(name, key string, count float64, sum float64, tags []string) (out []string) {
+	countDelta, hasCount := e.delta(key+"|count", count)
+	sumDelta, hasSum := e.delta(key+"|sum", sum)
+
+	if hasCount {
+		out = append(out, formatLine(name+".count", countDelta, "c", 1, tags))
+	}
+	if hasSum {
+		out = append(out, formatLine(name+".sum", sumDelta, "c", 1, tags))
+	}
+	if countDelta > 0 {
+		out = append(out, formatLine(name+".avg", sumDelta/countDelta, "g", 1, tags))
+	}
+
+	return out
+}
+
+func (e *Exporter) distributionLines(name, key string, histogram *dto.Histogram, tags []string) (out []string) {
+	previousCumulative := uint64(0)
+	lastFiniteBound := 0.0
+
+	emit := func(upperBound float64, cumulative uint64) {
+		observations := cumulative - previousCumulative
+		previousCumulative = cumulative
+
+		// Observations above the last bucket are reported at the last finite bound
+		value := lastFiniteBound
+		if !math.IsInf(upperBound, +1) {
+			value = upperBound
+			lastFiniteBound = upperBound
+		}
+
+		if delta, ok := e.delta(key+"|le="+formatFloat(upperBound), float64(observations)); ok && delta > 0 {
+			out = append(out, formatLine(name, value, "d", 1/delta, tags))
+		}
+	}
+
+	for _, bucket := range histogram.Bucket {
+		emit(bucket.GetUpperBound(), bucket.GetCumulativeCount())
+	}
+	if len(histogram.Bucket) == 0 || !math.IsInf(histogram.Bucket[len(histogram.Bucket)-1].GetUpperBound(), +1) {
+		emit(math.Inf(+1), histogram.GetSampleCount())
+	}
+
+	return out
+}
+
+// delta returns the difference between <value> and the value seen at the previous
+// flush for the same key. A value lower than the previous one is treated as a reset,
+// in which case the value itself is the delta. It returns false when there is
+// nothing to report.
+func (e *Exporter) delta(key string, value float64) (float64, bool) {
+	previous, found := e.previous[key]
+	e.previous[key] = value
+
+	if found && value >= previous {
+		return value - previous, value != previous
+	}
+
+	return value, value != 0
+}
+
+func (e *Exporter) metricTags(pairs []*dto.LabelPair) []string {
+	tags := make([]string, 0, len(e.tags)+len(pairs))
+	tags = append(tags, e.tags...)
+	for _, pair := range pairs {
+		tags = append(tags, formatTag(pair.GetName(), pair.GetValue()))
+	}
+
+	sort.Strings(tags)
+	return tags
+}
+
+func seriesKey(name string, tags []string) string {
+	return name + "|" + strings.Join(tags, ",")
+}
+
+func formatLine(name string, value float64, metricType string, sampleRate float64, tags []string) string {
+	line := name + ":" + formatFloat(value) + "|" + metricType
+	if sampleRate < 1 {
+		line += "|@" + formatFloat(sampleRate)
+	}
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	return line
+}
+
+var tagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+
+func formatTag(name, value string) string {
+	return tagReplacer.Replace(name) + ":" + tagReplacer.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,180 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAgent struct {
+	conn net.PacketConn
+}
+
+func newTestAgent(t *testing.T) *testAgent {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	return &testAgent{conn}
+}
+
+func (a *testAgent) addr() string { return a.conn.LocalAddr().String() }
+
+// packets reads the datagrams received until none is received for a little while
+func (a *testAgent) packets(t *testing.T) (out []string) {
+	buffer := make([]byte, 65536)
+	for {
+		require.NoError(t, a.conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		n, _, err := a.conn.ReadFrom(buffer)
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			return out
+		}
+		require.NoError(t, err)
+
+		out = append(out, string(buffer[:n]))
+	}
+}
+
+func (a *testAgent) lines(t *testing.T) (out []string) {
+	for _, packet := range a.packets(t) {
+		out = append(out, strings.Split(packet, "\n")...)
+	}
+	return out
+}
+
+func TestExporter_Flush(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.conn.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blocks"}, []string{"source"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "head"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency", Buckets: []float64{1, 5}})
+	registry.MustRegister(counter, gauge, histogram)
+
+	exporter, err := NewExporter(agent.addr(), registry, Prefix("firehose"), Tag("env", "test"))
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	counter.WithLabelValues("a").Add(3)
+	gauge.Set(42)
+	histogram.Observe(2)
+	histogram.Observe(4)
+
+	require.NoError(t, exporter.Flush())
+	assert.Equal(t, []string{
+		"firehose.blocks:3|c|#env:test,source:a",
+		"firehose.head:42|g|#env:test",
+		"firehose.latency.count:2|c|#env:test",
+		"firehose.latency.sum:6|c|#env:test",
+		"firehose.latency.avg:3|g|#env:test",
+	}, agent.lines(t))
+
+	counter.WithLabelValues("a").Add(2)
+	histogram.Observe(10)
+
+	require.NoError(t, exporter.Flush())
+	assert.Equal(t, []string{
+		"firehose.blocks:2|c|#env:test,source:a",
+		"firehose.head:42|g|#env:test",
+		"firehose.latency.count:1|c|#env:test",
+		"firehose.latency.sum:10|c|#env:test",
+		"firehose.latency.avg:10|g|#env:test",
+	}, agent.lines(t))
+}
+
+func TestExporter_Distribution(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.conn.Close()
+
+	registry := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency", Buckets: []float64{1, 5}})
+	registry.MustRegister(histogram)
+
+	exporter, err := NewExporter(agent.addr(), registry, Histograms(HistogramDistribution))
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+	histogram.Observe(3)
+	histogram.Observe(4)
+	histogram.Observe(8)
+
+	require.NoError(t, exporter.Flush())
+	assert.Equal(t, []string{
+		"latency:1|d",
+		"latency:5|d|@0.3333333333333333",
+		"latency:5|d",
+	}, agent.lines(t))
+
+	require.NoError(t, exporter.Flush())
+	assert.Len(t, agent.lines(t), 0)
+}
+
+func TestExporter_MaxPacketSize(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.conn.Close()
+
+	registry := prometheus.NewRegistry()
+	gauges := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "gauge"}, []string{"index"})
+	registry.MustRegister(gauges)
+	for _, index := range []string{"a", "b", "c", "d"} {
+		gauges.WithLabelValues(index).Set(1)
+	}
+
+	exporter, err := NewExporter(agent.addr(), registry, MaxPacketSize(40))
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	require.NoError(t, exporter.Flush())
+	assert.Equal(t, []string{
+		"gauge:1|g|#index:a\ngauge:1|g|#index:b",
+		"gauge:1|g|#index:c\ngauge:1|g|#index:d",
+	}, agent.packets(t))
+}
+
+func TestExporter_Periodic(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.conn.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge"})
+	registry.MustRegister(gauge)
+
+	exporter, err := NewExporter(agent.addr(), registry, FlushInterval(20*time.Millisecond))
+	require.NoError(t, err)
+
+	exporter.Start(context.Background())
+	time.Sleep(70 * time.Millisecond)
+	require.NoError(t, exporter.Close())
+
+	// At least 2 periodic flushes plus the final one on close
+	assert.GreaterOrEqual(t, len(agent.lines(t)), 3)
+}
+
+func TestExporter_Prefix(t *testing.T) {
+	for prefix, expected := range map[string]string{"": "", ".": "", "firehose": "firehose.", "firehose.": "firehose."} {
+		exporter, err := NewExporter("127.0.0.1:8125", prometheus.NewRegistry(), Prefix(prefix))
+		require.NoError(t, err)
+		assert.Equal(t, expected, exporter.prefix, "prefix %q", prefix)
+		require.NoError(t, exporter.Close())
+	}
+}
+
+func TestExporter_InvalidFlushInterval(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.conn.Close()
+
+	exporter, err := NewExporter(agent.addr(), prometheus.NewRegistry(), FlushInterval(0))
+	require.NoError(t, err)
+	assert.Equal(t, defaultFlushInterval, exporter.interval)
+
+	exporter.Start(context.Background())
+	require.NoError(t, exporter.Close())
+}
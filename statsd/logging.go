@@ -0,0 +1,7 @@
+package statsd
+
+import (
+	"github.com/streamingfast/logging"
+)
+
+var zlog, _ = logging.PackageLogger("statsd", "github.com/streamingfast/dmetrics/statsd")